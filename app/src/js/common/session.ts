@@ -29,6 +29,12 @@ class Session {
   public devMode: boolean
   /** Connection status */
   public status: ConnectionStatus
+  /** Revision of the task the next save is based on */
+  public revision: number
+  /** Whether another session holds the lock of the task */
+  public readOnly: boolean
+  /** User holding the lock of the task of a read-only session */
+  public lockHolder: string
 
   /**
    * no-op for state initialization
@@ -41,6 +47,25 @@ class Session {
     this.devMode = true
     this.store = configureStore({}, this.devMode)
     this.status = ConnectionStatus.UNSAVED
+    this.revision = 0
+    this.readOnly = false
+    this.lockHolder = ''
+  }
+
+  /**
+   * Update whether the session may save the task. The user is warned when
+   * the session becomes read-only, because the changes are not saved then.
+   * @param {boolean} readOnly: whether another session holds the lock
+   * @param {string} lockHolder: user holding the lock
+   */
+  public setReadOnly (readOnly: boolean, lockHolder: string = '') {
+    const warn = readOnly && (!this.readOnly || lockHolder !== this.lockHolder)
+    this.readOnly = readOnly
+    this.lockHolder = readOnly ? lockHolder : ''
+    if (warn) {
+      alert(lockHolder + ' is editing this task. ' +
+        'Your changes will not be saved.')
+    }
   }
 
   /**
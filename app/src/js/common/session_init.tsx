@@ -29,6 +29,7 @@ export function initSession (containerName: string): void {
     if (xhr.readyState === 4) {
       const json = JSON.parse(xhr.response)
       initFromJson(json)
+      keepTaskLock()
       ReactDOM.render(
                      <MuiThemeProvider theme={myTheme}>
                 <Window />
@@ -61,6 +62,11 @@ export function initSession (containerName: string): void {
  */
 export function initStore (stateJson: {}): void {
   Session.store = configureStore(stateJson, Session.devMode)
+  // the revision is kept out of the store, so that undo does not restore it
+  Session.revision = _.get(stateJson, 'revision', 0)
+  Session.readOnly = false
+  Session.setReadOnly(_.get(stateJson, 'session.readOnly', false),
+    _.get(stateJson, 'session.lockHolder', ''))
   Session.dispatch(initSessionAction())
   const state = Session.getState()
   Session.itemType = state.task.config.itemType
@@ -76,6 +82,51 @@ function initFromJson (stateJson: {}): void {
   Session.dispatch(updateAll())
 }
 
+/**
+ * Update the session by the response to a heartbeat. A session loses the
+ * lock when it is taken over, and read-only sessions get the lock once it
+ * is released.
+ * @param {XMLHttpRequest} xhr: finished heartbeat request
+ */
+export function updateTaskLock (xhr: XMLHttpRequest): void {
+  if (xhr.status !== 200) {
+    return
+  }
+  const response = JSON.parse(xhr.response)
+  Session.setReadOnly(response.readOnly, response.lockHolder)
+}
+
+/**
+ * Keep the lock of the task while the session is open by heartbeats.
+ * The heartbeats of read-only sessions take the lock once it is free.
+ */
+function keepTaskLock (): void {
+  const state = Session.getState()
+  const lockForm = () => {
+    const form = new FormData()
+    form.append('project_name', state.task.config.projectName)
+    form.append('task_index',
+      parseInt(state.task.config.taskId, 10).toString())
+    form.append('session_id', state.session.id)
+    return form
+  }
+  // the server keeps the lock for a minute without a heartbeat
+  const heartbeatInterval = 20000
+  setInterval(() => {
+    const xhr = new XMLHttpRequest()
+    xhr.onreadystatechange = () => {
+      if (xhr.readyState === 4) {
+        updateTaskLock(xhr)
+      }
+    }
+    xhr.open('POST', './taskLock')
+    xhr.send(lockForm())
+  }, heartbeatInterval)
+  window.addEventListener('unload', () => {
+    navigator.sendBeacon('./releaseTaskLock', lockForm())
+  })
+}
+
 /**
  * Set listeners for the html body
  */
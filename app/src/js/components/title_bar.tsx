@@ -50,10 +50,47 @@ interface Props {
   instructionLink: string
 }
 
+/**
+ * Handle the response of a save. Saves based on a revision get the new
+ * revision, saves based on an older revision are rejected with a conflict
+ * and saves of a session without the lock of the task are rejected as
+ * locked.
+ * @param {XMLHttpRequest} xhr: finished save request
+ */
+function handleSaveResponse (xhr: XMLHttpRequest) {
+  if (xhr.status === 409) {
+    alert('This task was saved in another session. ' +
+      'Reload the page to get the latest labels before saving again.')
+    return
+  }
+  if (xhr.status === 423) {
+    const locked = JSON.parse(xhr.response)
+    Session.setReadOnly(true, locked.lockHolder)
+    return
+  }
+  if (xhr.status !== 200) {
+    alert('Save failed.')
+    return
+  }
+  const response = JSON.parse(xhr.response)
+  if (response !== null && typeof response.revision === 'number') {
+    Session.revision = response.revision
+  } else if (response !== 0) {
+    alert('Save failed.')
+  }
+}
+
 /**
  * Save the current state to the server
+ * @param {TitleBar} callerComponent: title bar showing the save status
+ * @param {boolean} submit: whether the save is a submission of the task
  */
-function save (callerComponent: TitleBar) {
+function save (callerComponent: TitleBar, submit: boolean = false) {
+  if (Session.readOnly) {
+    alert(Session.lockHolder + ' is editing this task. ' +
+      'Your changes cannot be saved.')
+    return
+  }
   Session.status = ConnectionStatus.SAVING
   callerComponent.forceUpdate()
   const state = Session.getState()
@@ -66,13 +103,11 @@ function save (callerComponent: TitleBar) {
         Session.status = ConnectionStatus.UNSAVED
         callerComponent.forceUpdate()
       }, 5000)
-      if (JSON.parse(xhr.response) !== 0) {
-        alert('Save failed.')
-      }
+      handleSaveResponse(xhr)
     }
   }
   xhr.open('POST', './postSaveV2')
-  xhr.send(JSON.stringify(state))
+  xhr.send(JSON.stringify({ ...state, revision: Session.revision, submit }))
 }
 
 /**
@@ -113,7 +148,10 @@ class TitleBar extends Component<Props> {
         icon: fa.faColumns
       },
       { title: 'Save', onClick: () => { save(this) }, icon: fa.faSave },
-      { title: 'Submit', onClick: () => { save(this) }, icon: fa.faCheck }
+      {
+        title: 'Submit', onClick: () => { save(this, true) },
+        icon: fa.faCheck
+      }
     ]
     const buttons = buttonInfo.map((b) => {
       const onClick = _.get(b, 'onClick', undefined)
@@ -398,7 +398,16 @@ Sat.prototype.save = function() {
   let xhr = new XMLHttpRequest();
   xhr.onreadystatechange = function() {
     if (xhr.readyState === 4) {
-      if (JSON.parse(xhr.response) === 0) {
+      if (xhr.status === 409) {
+        alert('The task was saved somewhere else since it was loaded. ' +
+            'Reload the page to get the latest labels.');
+        return;
+      }
+      let response = JSON.parse(xhr.response);
+      if (response === 0 || (response && response.revision)) {
+        if (response.revision) {
+          self.revision = response.revision;
+        }
         alert('Saved successfully.');
       }
     }
@@ -463,6 +472,7 @@ Sat.prototype.encodeBaseJson = function() {
     labels: labels,
     events: self.events,
     startTime: self.startTime,
+    revision: self.revision,
     numLabeledItems: labeledItemsCount,
     userAgent: navigator.userAgent,
     ipInfo: self.ipInfo,
@@ -517,6 +527,7 @@ Sat.prototype.decodeBaseJson = function(json) {
   self.workerId = json.workerId;
   self.events = json.events; // TODO: don't deserialize all events
   self.startTime = json.startTime;
+  self.revision = json.revision;
 
   self.currentItem = self.items[0];
 
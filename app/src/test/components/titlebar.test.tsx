@@ -2,7 +2,7 @@ import { MuiThemeProvider } from '@material-ui/core/styles'
 import { cleanup, fireEvent, render } from '@testing-library/react'
 import * as React from 'react'
 import Session, { ConnectionStatus } from '../../js/common/session'
-import { initStore } from '../../js/common/session_init'
+import { initStore, updateTaskLock } from '../../js/common/session_init'
 import TitleBar from '../../js/components/title_bar'
 import { myTheme } from '../../js/styles/theme'
 
@@ -27,6 +27,7 @@ const xhrMockClass = {
   send: jest.fn(),
   onreadystatechange: jest.fn(),
   readyState: 4,
+  status: 200,
   response: JSON.stringify(0)
 };
 (window as any).XMLHttpRequest =
@@ -36,6 +37,7 @@ window.alert = jest.fn()
 
 describe('Save button functionality', () => {
   let saveButton: HTMLElement
+  let submitButton: HTMLElement
 
   beforeEach(() => {
     initStore({
@@ -47,7 +49,8 @@ describe('Save button functionality', () => {
       },
       session: {
         sessionTestKey: 'sessionTestValue'
-      }
+      },
+      revision: 7
     })
     jest.clearAllMocks()
     // recreate for each test because of timeout side effects
@@ -61,6 +64,7 @@ describe('Save button functionality', () => {
       </MuiThemeProvider>
     )
     saveButton = getByTestId('Save')
+    submitButton = getByTestId('Submit')
   })
 
   test('Save button triggers save', () => {
@@ -79,6 +83,84 @@ describe('Save button functionality', () => {
     xhrMockClass.onreadystatechange()
   })
 
+  test('Only the submit button submits the task', () => {
+    fireEvent.click(saveButton)
+    expect(xhrMockClass.send).toBeCalledWith(
+      expect.stringContaining('"submit":false')
+    )
+    xhrMockClass.onreadystatechange()
+
+    fireEvent.click(submitButton)
+    expect(xhrMockClass.send).toBeCalledWith(
+      expect.stringContaining('"submit":true')
+    )
+    xhrMockClass.onreadystatechange()
+  })
+
+  test('Saves are based on the latest revision', () => {
+    fireEvent.click(saveButton)
+    expect(xhrMockClass.send).toBeCalledWith(
+      expect.stringContaining('"revision":7')
+    )
+    xhrMockClass.response = JSON.stringify({ revision: 8 })
+    xhrMockClass.onreadystatechange()
+    expect(window.alert).not.toBeCalled()
+    expect(Session.revision).toBe(8)
+
+    fireEvent.click(saveButton)
+    expect(xhrMockClass.send).toBeCalledWith(
+      expect.stringContaining('"revision":8')
+    )
+    xhrMockClass.response = JSON.stringify(0)
+    xhrMockClass.onreadystatechange()
+  })
+
+  test('Warns about a save of an older revision', () => {
+    fireEvent.click(saveButton)
+    xhrMockClass.status = 409
+    xhrMockClass.response = JSON.stringify({ revision: 9 })
+    xhrMockClass.onreadystatechange()
+    expect(window.alert).toBeCalledWith(
+      expect.stringContaining('saved in another session')
+    )
+    expect(Session.revision).toBe(7)
+
+    xhrMockClass.status = 200
+    xhrMockClass.response = JSON.stringify(0)
+  })
+
+  test('Alerts on a save failure without json', () => {
+    fireEvent.click(saveButton)
+    xhrMockClass.status = 500
+    xhrMockClass.response = 'Internal Server Error'
+    xhrMockClass.onreadystatechange()
+    expect(window.alert).toBeCalledWith('Save failed.')
+
+    xhrMockClass.status = 200
+    xhrMockClass.response = JSON.stringify(0)
+  })
+
+  test('Stops saving after losing the lock of the task', () => {
+    fireEvent.click(saveButton)
+    xhrMockClass.status = 423
+    xhrMockClass.response = JSON.stringify({
+      lock: { workerId: 'alice' }, readOnly: true, lockHolder: 'Alice'
+    })
+    xhrMockClass.onreadystatechange()
+    expect(window.alert).toBeCalledWith(
+      expect.stringContaining('Alice is editing this task')
+    )
+    expect(Session.readOnly).toBe(true)
+
+    jest.clearAllMocks()
+    fireEvent.click(saveButton)
+    expect(xhrMockClass.send).not.toBeCalled()
+    expect(window.alert).toBeCalled()
+
+    xhrMockClass.status = 200
+    xhrMockClass.response = JSON.stringify(0)
+  })
+
   test('Sync status is correct during save', () => {
     expect(Session.status).toBe(ConnectionStatus.SAVED)
     fireEvent.click(saveButton)
@@ -99,3 +181,41 @@ describe('Save button functionality', () => {
     xhrMockClass.response = JSON.stringify(0)
   })
 })
+
+describe('Task lock heartbeats', () => {
+  beforeEach(() => {
+    initStore({
+      task: {},
+      user: {},
+      session: { readOnly: true, lockHolder: 'Alice' }
+    })
+  })
+
+  test('Read-only sessions warn about the lock holder', () => {
+    expect(Session.readOnly).toBe(true)
+    expect(window.alert).toBeCalledWith(
+      expect.stringContaining('Alice is editing this task')
+    )
+  })
+
+  test('Heartbeats update whether the session is read-only', () => {
+    updateTaskLock({
+      status: 200,
+      response: JSON.stringify({ lock: {}, readOnly: false })
+    } as XMLHttpRequest)
+    expect(Session.readOnly).toBe(false)
+
+    jest.clearAllMocks()
+    updateTaskLock({
+      status: 200,
+      response: JSON.stringify({
+        lock: {}, readOnly: true, lockHolder: 'Bob'
+      })
+    } as XMLHttpRequest)
+    expect(Session.readOnly).toBe(true)
+    expect(Session.lockHolder).toBe('Bob')
+    expect(window.alert).toBeCalledWith(
+      expect.stringContaining('Bob is editing this task')
+    )
+  })
+})
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// minimum IoU of the shapes of two matched labels
+const agreementMatchIoU = 0.5
+
+// default score below which an item is flagged
+const defaultAgreementThreshold = 0.5
+
+// number of samples along the longer side of the area of two polygons
+const maskResolution = 200
+
+// Agreement of two workers on a task
+type PairAgreement struct {
+	Workers [2]string `json:"workers"`
+	// mean IoU of the matched labels of the same category, unmatched labels
+	// count as 0
+	Labels float64 `json:"labels"`
+	// fraction of the attributes with the same value on the items and the
+	// matched labels
+	Attributes float64 `json:"attributes"`
+}
+
+// Agreement on the labels of a category
+type CategoryAgreement struct {
+	Category string  `json:"category"`
+	Labels   float64 `json:"labels"`
+	// number of labels of the category, counted once for each pair
+	NumLabels int `json:"numLabels"`
+}
+
+// Item on which two workers disagree
+type ItemAgreement struct {
+	TaskIndex  int       `json:"taskIndex"`
+	ItemIndex  int       `json:"itemIndex"`
+	Name       string    `json:"name"`
+	Workers    [2]string `json:"workers"`
+	Labels     float64   `json:"labels"`
+	Attributes float64   `json:"attributes"`
+}
+
+// Agreement of the workers of a task
+type TaskAgreement struct {
+	TaskIndex  int                 `json:"taskIndex"`
+	Workers    []string            `json:"workers"`
+	Pairs      []PairAgreement     `json:"pairs"`
+	Categories []CategoryAgreement `json:"categories"`
+}
+
+// Inter-annotator agreement of a project
+type AgreementReport struct {
+	ProjectName string              `json:"projectName"`
+	Threshold   float64             `json:"threshold"`
+	Tasks       []TaskAgreement     `json:"tasks"`
+	Categories  []CategoryAgreement `json:"categories"`
+	Flagged     []ItemAgreement     `json:"flagged"`
+}
+
+// Sums of the IoU and of the number of labels of each category
+type categoryCounts map[string]*[2]float64
+
+func (counts categoryCounts) add(category string, iou float64,
+	numLabels int) {
+	if _, ok := counts[category]; !ok {
+		counts[category] = &[2]float64{}
+	}
+	counts[category][0] += iou
+	counts[category][1] += float64(numLabels)
+}
+
+func (counts categoryCounts) merge(other categoryCounts) {
+	for category, count := range other {
+		counts.add(category, count[0], int(count[1]))
+	}
+}
+
+// Lists the agreement of each category by name
+func (counts categoryCounts) agreements() []CategoryAgreement {
+	agreements := []CategoryAgreement{}
+	for category, count := range counts {
+		agreements = append(agreements, CategoryAgreement{
+			Category:  category,
+			Labels:    count[0] / count[1],
+			NumLabels: int(count[1]),
+		})
+	}
+	sort.Slice(agreements, func(i, j int) bool {
+		return agreements[i].Category < agreements[j].Category
+	})
+	return agreements
+}
+
+// ComputeAgreement compares the submissions of every pair of workers of the
+// tasks. exportTask reads the submissions of a worker, so that v1
+// assignments and v2 sats are compared the same way. Items with a label or
+// attribute agreement below threshold are flagged.
+func ComputeAgreement(project Project, tasks []Task, filter ExportFilter,
+	exportTask exportTaskFunc, threshold float64) AgreementReport {
+	report := AgreementReport{
+		ProjectName: project.Options.Name,
+		Threshold:   threshold,
+		Tasks:       []TaskAgreement{},
+		Flagged:     []ItemAgreement{},
+	}
+	projectCounts := categoryCounts{}
+	for _, task := range filter.filterTasks(tasks) {
+		workers, workerItems := exportWorkerItems(project, task, filter,
+			exportTask)
+		if len(workers) < 2 {
+			continue
+		}
+		taskAgreement := TaskAgreement{
+			TaskIndex: task.Index,
+			Workers:   workers,
+			Pairs:     []PairAgreement{},
+		}
+		taskCounts := categoryCounts{}
+		for i := 0; i < len(workers); i++ {
+			for j := i + 1; j < len(workers); j++ {
+				pair := PairAgreement{
+					Workers: [2]string{workers[i], workers[j]},
+				}
+				numItems := Min(len(workerItems[i]), len(workerItems[j]))
+				for k := 0; k < numItems; k++ {
+					itemA, itemB := workerItems[i][k], workerItems[j][k]
+					labels, attributes := compareItems(itemA, itemB, taskCounts)
+					pair.Labels += labels / float64(numItems)
+					pair.Attributes += attributes / float64(numItems)
+					if labels < threshold || attributes < threshold {
+						report.Flagged = append(report.Flagged, ItemAgreement{
+							TaskIndex:  task.Index,
+							ItemIndex:  itemA.Index,
+							Name:       itemA.Name,
+							Workers:    pair.Workers,
+							Labels:     labels,
+							Attributes: attributes,
+						})
+					}
+				}
+				taskAgreement.Pairs = append(taskAgreement.Pairs, pair)
+			}
+		}
+		taskAgreement.Categories = taskCounts.agreements()
+		projectCounts.merge(taskCounts)
+		report.Tasks = append(report.Tasks, taskAgreement)
+	}
+	report.Categories = projectCounts.agreements()
+	return report
+}
+
+// Exports the items of a task for each worker who saved a submission
+func exportWorkerItems(project Project, task Task, filter ExportFilter,
+	exportTask exportTaskFunc) ([]string, [][]ItemExport) {
+	workers := []string{}
+	workerItems := [][]ItemExport{}
+	for _, workerId := range GetTaskWorkers(project.Options.Name,
+		Index2str(task.Index)) {
+		workerFilter := filter
+		workerFilter.Worker = workerId
+		workerFilter.IncludeUnlabeled = false
+		workerFilter.Consensus = false
+		items := filter.filterLabels(exportTask(project, task, workerFilter))
+		if len(items) == 0 {
+			continue
+		}
+		workers = append(workers, workerId)
+		workerItems = append(workerItems, items)
+	}
+	return workers, workerItems
+}
+
+// Compares the labels of an item by two workers. Labels are matched by
+// the IoU of their shapes, labels without comparable shapes are matched by
+// category. Returns the label and attribute agreement, and adds the
+// matches to the counts of the categories.
+func compareItems(itemA ItemExport, itemB ItemExport,
+	counts categoryCounts) (float64, float64) {
+	type match struct {
+		a, b int
+		iou  float64
+	}
+	candidates := []match{}
+	for a, labelA := range itemA.Labels {
+		for b, labelB := range itemB.Labels {
+			iou, ok := labelIoU(labelA, labelB)
+			if !ok {
+				if labelA.Category != labelB.Category {
+					continue
+				}
+				iou = 1
+			}
+			if iou >= agreementMatchIoU {
+				candidates = append(candidates, match{a, b, iou})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].iou > candidates[j].iou
+	})
+	matchedA := map[int]bool{}
+	matchedB := map[int]bool{}
+	matches := []match{}
+	for _, candidate := range candidates {
+		if matchedA[candidate.a] || matchedB[candidate.b] {
+			continue
+		}
+		matchedA[candidate.a] = true
+		matchedB[candidate.b] = true
+		matches = append(matches, candidate)
+	}
+
+	// labels
+	numA := map[string]int{}
+	numB := map[string]int{}
+	for _, label := range itemA.Labels {
+		numA[label.Category]++
+	}
+	for _, label := range itemB.Labels {
+		numB[label.Category]++
+	}
+	ious := map[string]float64{}
+	totalIoU := 0.0
+	for _, m := range matches {
+		category := itemA.Labels[m.a].Category
+		if category == itemB.Labels[m.b].Category {
+			ious[category] += m.iou
+			totalIoU += m.iou
+		}
+	}
+	for category, num := range numA {
+		counts.add(category, ious[category], Max(num, numB[category]))
+	}
+	for category, num := range numB {
+		if _, ok := numA[category]; !ok {
+			counts.add(category, 0, num)
+		}
+	}
+	labels := 1.0
+	if numLabels := Max(len(itemA.Labels), len(itemB.Labels)); numLabels > 0 {
+		labels = totalIoU / float64(numLabels)
+	}
+
+	// attributes
+	attributeScores := []float64{}
+	if len(itemA.Attributes) > 0 || len(itemB.Attributes) > 0 {
+		attributesA := map[string]interface{}{}
+		attributesB := map[string]interface{}{}
+		for key, value := range itemA.Attributes {
+			attributesA[key] = value
+		}
+		for key, value := range itemB.Attributes {
+			attributesB[key] = value
+		}
+		attributeScores = append(attributeScores,
+			attributeAgreement(attributesA, attributesB))
+	}
+	for _, m := range matches {
+		labelA, labelB := itemA.Labels[m.a], itemB.Labels[m.b]
+		if len(labelA.Attributes) > 0 || len(labelB.Attributes) > 0 {
+			attributeScores = append(attributeScores,
+				attributeAgreement(labelA.Attributes, labelB.Attributes))
+		}
+	}
+	attributes := 1.0
+	if len(attributeScores) > 0 {
+		attributes = 0
+		for _, score := range attributeScores {
+			attributes += score / float64(len(attributeScores))
+		}
+	}
+	return labels, attributes
+}
+
+// Fraction of the attributes of either map with the same value in both
+func attributeAgreement(a map[string]interface{},
+	b map[string]interface{}) float64 {
+	keys := map[string]bool{}
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	if len(keys) == 0 {
+		return 1
+	}
+	same := 0
+	for key := range keys {
+		valueA, okA := a[key]
+		valueB, okB := b[key]
+		// values are compared by their text since saved and exported
+		// values differ in numeric types
+		if okA && okB && fmt.Sprint(valueA) == fmt.Sprint(valueB) {
+			same++
+		}
+	}
+	return float64(same) / float64(len(keys))
+}
+
+// Computes the IoU of the shapes of two labels. Returns false if the
+// labels have no shapes that can be compared.
+func labelIoU(a LabelExport, b LabelExport) (float64, bool) {
+	if len(a.Box2d) > 0 && len(b.Box2d) > 0 {
+		return boxIoU(a.Box2d, b.Box2d), true
+	}
+	if len(a.Poly2d) > 0 && len(b.Poly2d) > 0 {
+		return polyIoU(a.Poly2d, b.Poly2d), true
+	}
+	return 0, false
+}
+
+// Bounds of a shape as x1, y1, x2, y2
+type bounds [4]float64
+
+func (box bounds) area() float64 {
+	return math.Max(box[2]-box[0], 0) * math.Max(box[3]-box[1], 0)
+}
+
+func (box bounds) union(other bounds) bounds {
+	return bounds{math.Min(box[0], other[0]), math.Min(box[1], other[1]),
+		math.Max(box[2], other[2]), math.Max(box[3], other[3])}
+}
+
+func (box bounds) intersection(other bounds) bounds {
+	return bounds{math.Max(box[0], other[0]), math.Max(box[1], other[1]),
+		math.Min(box[2], other[2]), math.Min(box[3], other[3])}
+}
+
+func boundsIoU(a bounds, b bounds) float64 {
+	intersection := a.intersection(b).area()
+	union := a.area() + b.area() - intersection
+	if union <= 0 {
+		return 0
+	}
+	return intersection / union
+}
+
+// Gets a number of an exported shape, which is decoded from json as float64
+func shapeNumber(shape map[string]interface{}, key string) float64 {
+	switch value := shape[key].(type) {
+	case float64:
+		return value
+	case int:
+		return float64(value)
+	case string:
+		number, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return number
+		}
+	}
+	return 0
+}
+
+// IoU of two exported 2d boxes
+func boxIoU(a map[string]interface{}, b map[string]interface{}) float64 {
+	boxBounds := func(box map[string]interface{}) bounds {
+		return bounds{shapeNumber(box, "x1"), shapeNumber(box, "y1"),
+			shapeNumber(box, "x2"), shapeNumber(box, "y2")}
+	}
+	return boundsIoU(boxBounds(a), boxBounds(b))
+}
+
+// Bounds of the vertices of polygons
+func polyBounds(polys []Poly2d) bounds {
+	box := bounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, poly := range polys {
+		for _, vertex := range poly.Vertices {
+			if len(vertex) < 2 {
+				continue
+			}
+			box = box.union(bounds{vertex[0], vertex[1], vertex[0], vertex[1]})
+		}
+	}
+	return box
+}
+
+// Checks if a point is inside any of the polygons by the even-odd rule.
+// Control points of curves are taken as vertices.
+func insidePolys(polys []Poly2d, x float64, y float64) bool {
+	for _, poly := range polys {
+		inside := false
+		n := len(poly.Vertices)
+		for i, j := 0, n-1; i < n; j, i = i, i+1 {
+			vi, vj := poly.Vertices[i], poly.Vertices[j]
+			if len(vi) < 2 || len(vj) < 2 {
+				continue
+			}
+			if (vi[1] > y) != (vj[1] > y) &&
+				x < (vj[0]-vi[0])*(y-vi[1])/(vj[1]-vi[1])+vi[0] {
+				inside = !inside
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask IoU of two polygon labels, computed on a grid over their area. Open
+// paths such as lanes have no area and are compared by their bounds.
+func polyIoU(a []Poly2d, b []Poly2d) float64 {
+	for _, poly := range append(append([]Poly2d{}, a...), b...) {
+		if !poly.Closed {
+			return boundsIoU(polyBounds(a), polyBounds(b))
+		}
+	}
+	area := polyBounds(a).union(polyBounds(b))
+	step := math.Max(area[2]-area[0], area[3]-area[1]) / maskResolution
+	if step <= 0 || math.IsInf(step, 0) || math.IsNaN(step) {
+		return 0
+	}
+	intersection, union := 0, 0
+	for y := area[1] + step/2; y < area[3]; y += step {
+		for x := area[0] + step/2; x < area[2]; x += step {
+			insideA, insideB := insidePolys(a, x, y), insidePolys(b, x, y)
+			if insideA && insideB {
+				intersection++
+			}
+			if insideA || insideB {
+				union++
+			}
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
+
+// Handles the agreement report of a project. The report covers the tasks
+// selected by the export filter fields.
+func getAgreementHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can see the agreement of workers",
+			http.StatusForbidden)
+		return
+	}
+	projectName := r.FormValue("project_name")
+	project, err := GetProject(projectName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	filter, ok := getRequestExportFilter(w, r)
+	if !ok {
+		return
+	}
+	threshold := float64(defaultAgreementThreshold)
+	if value := r.FormValue("threshold"); value != "" {
+		threshold, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, "Invalid threshold", http.StatusBadRequest)
+			return
+		}
+	}
+	tasks, err := GetTasksInProject(projectName)
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report := ComputeAgreement(project, tasks, filter,
+		projectExportTask(project), threshold)
+	reportJson, err := json.Marshal(report)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(reportJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const agreementTestProject = "scalabel_agreement_test"
+
+func TestShapeIoU(t *testing.T) {
+	a := map[string]interface{}{"x1": 0.0, "y1": 0.0, "x2": 10.0, "y2": 10.0}
+	b := map[string]interface{}{"x1": 5.0, "y1": 0.0, "x2": 15.0, "y2": 10.0}
+	if iou := boxIoU(a, b); math.Abs(iou-1.0/3) > 1e-9 {
+		t.Error("wrong box IoU", iou)
+	}
+	square := func(x float64) []Poly2d {
+		return []Poly2d{{Vertices: [][]float64{{x, 0}, {x + 10, 0},
+			{x + 10, 10}, {x, 10}}, Types: "LLLL", Closed: true}}
+	}
+	if iou := polyIoU(square(0), square(5)); math.Abs(iou-1.0/3) > 0.02 {
+		t.Error("wrong mask IoU", iou)
+	}
+	triangle := []Poly2d{{Vertices: [][]float64{{0, 0}, {10, 0}, {0, 10}},
+		Types: "LLL", Closed: true}}
+	if iou := polyIoU(square(0), triangle); math.Abs(iou-0.5) > 0.02 {
+		t.Error("wrong mask IoU", iou)
+	}
+	if iou := polyIoU(square(0), square(20)); iou != 0 {
+		t.Error("expected disjoint polygons not to overlap, got", iou)
+	}
+}
+
+func TestAttributeAgreement(t *testing.T) {
+	a := map[string]interface{}{"occluded": true, "color": []int{1, 2}}
+	b := map[string]interface{}{"occluded": true,
+		"color": []interface{}{1, 3}, "truncated": false}
+	if score := attributeAgreement(a, b); math.Abs(score-1.0/3) > 1e-9 {
+		t.Error("wrong attribute agreement", score)
+	}
+}
+
+// Saves the submissions of a task by three workers. alice and bob agree,
+// carol labels a different box.
+func saveAgreementTestSubmissions(t *testing.T) Project {
+	boxes := map[string]map[string]interface{}{
+		"alice": {"x": 0, "y": 0, "w": 10, "h": 10},
+		"bob":   {"x": 1, "y": 0, "w": 10, "h": 10},
+		"carol": {"x": 50, "y": 50, "w": 10, "h": 10},
+	}
+	submissions := []testSubmission{}
+	for workerId, box := range boxes {
+		submissions = append(submissions, testSubmission{workerId: workerId,
+			submitTime: 1, labels: []Label{{Id: 0, CategoryPath: "car",
+				Data:       box,
+				Attributes: map[string]interface{}{"occluded": false}}}})
+	}
+	project, _ := saveTestProject(t, agreementTestProject,
+		[][]Item{{{Url: "a.jpg"}}}, submissions)
+	return project
+}
+
+func TestComputeAgreement(t *testing.T) {
+	project := saveAgreementTestSubmissions(t)
+	defer deleteTestProject(t, agreementTestProject)
+	tasks, err := GetTasksInProject(agreementTestProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := ExportFilter{TaskEnd: -1, IncludeUnlabeled: true}
+	report := ComputeAgreement(project, tasks, filter, exportTaskItems, 0.5)
+	if len(report.Tasks) != 1 || len(report.Tasks[0].Pairs) != 3 {
+		t.Fatal("expected the three pairs of workers, got", report)
+	}
+	for _, pair := range report.Tasks[0].Pairs {
+		agree := pair.Workers == [2]string{"alice", "bob"}
+		if agree && (math.Abs(pair.Labels-9.0/11) > 1e-9 ||
+			pair.Attributes != 1) {
+			t.Error("wrong agreement of alice and bob", pair)
+		}
+		if !agree && pair.Labels != 0 {
+			t.Error("expected carol to disagree, got", pair)
+		}
+	}
+	if len(report.Flagged) != 2 {
+		t.Error("expected the items of carol to be flagged, got",
+			report.Flagged)
+	}
+	categories := report.Categories
+	if len(categories) != 1 || categories[0].Category != "car" ||
+		categories[0].NumLabels != 3 ||
+		math.Abs(categories[0].Labels-3.0/11) > 1e-9 {
+		t.Error("wrong category agreement", categories)
+	}
+}
+
+func TestAgreementHandler(t *testing.T) {
+	project := saveAgreementTestSubmissions(t)
+	err := storage.Save(project.GetKey(), project.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deleteTestProject(t, agreementTestProject)
+	req, err := http.NewRequest("GET", "/agreement?project_name="+
+		agreementTestProject+"&threshold=0.9", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	getAgreementHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Agreement handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	report := AgreementReport{}
+	err = json.Unmarshal(rr.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// alice and bob are flagged too at the higher threshold
+	if report.Threshold != 0.9 || len(report.Flagged) != 3 {
+		t.Error("wrong report", report)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default time in seconds for which a cached key is used
+const defaultCacheTtl = 60
+
+// Settings of the read cache of the storage
+type CacheConfig struct {
+	// maximum number of cached keys, the cache is off if it is 0
+	Size int `yaml:"size"`
+	// time in seconds for which a cached key is used
+	Ttl int `yaml:"ttl"`
+}
+
+// Counts of the reads served by the cache
+type CacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+	// number of cached keys
+	Size int `json:"size"`
+}
+
+// A cached key, which is missing from the storage if it does not exist.
+// The fields are kept as json, so that loads get copies.
+type cacheEntry struct {
+	key        string
+	exists     bool
+	fieldsJson []byte
+	expireTime time.Time
+}
+
+//implement Storage interface
+// Caches the loads of another storage in a least recently used cache. The
+// keys are invalidated by the saves and deletes of this server, the saves
+// of other servers are seen once the cached keys expire.
+type CachedStorage struct {
+	backend Storage
+	size    int
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	// cached entries from the most to the least recently used
+	order *list.List
+	// incremented by each invalidation, so that a load which raced with a
+	// save does not cache the old fields
+	generation int64
+	hits       int64
+	misses     int64
+}
+
+func NewCachedStorage(backend Storage, config CacheConfig) *CachedStorage {
+	ttl := config.Ttl
+	if ttl <= 0 {
+		ttl = defaultCacheTtl
+	}
+	return &CachedStorage{
+		backend: backend,
+		size:    config.Size,
+		ttl:     time.Duration(ttl) * time.Second,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Gets the storage under the cache
+func unwrapStorage(s Storage) Storage {
+	if cachedStorage, ok := s.(*CachedStorage); ok {
+		return cachedStorage.backend
+	}
+	return s
+}
+
+func (cs *CachedStorage) Init(path string) error {
+	cs.lock.Lock()
+	cs.entries = map[string]*list.Element{}
+	cs.order.Init()
+	cs.generation++
+	cs.lock.Unlock()
+	return cs.backend.Init(path)
+}
+
+// Gets the cached entry of a key if it did not expire, and counts the hit
+// or the miss. An existing key cached by HasKey misses if the fields are
+// needed. Returns the generation of the cache to store a missed key.
+func (cs *CachedStorage) get(key string, needFields bool) (*cacheEntry,
+	int64) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	element, ok := cs.entries[key]
+	if ok {
+		entry := element.Value.(*cacheEntry)
+		if !time.Now().Before(entry.expireTime) {
+			cs.order.Remove(element)
+			delete(cs.entries, key)
+		} else if !needFields || !entry.exists || entry.fieldsJson != nil {
+			cs.hits++
+			cs.order.MoveToFront(element)
+			return entry, cs.generation
+		}
+	}
+	cs.misses++
+	return nil, cs.generation
+}
+
+// Caches an entry unless a key was invalidated since the generation
+func (cs *CachedStorage) put(entry *cacheEntry, generation int64) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if generation != cs.generation {
+		return
+	}
+	entry.expireTime = time.Now().Add(cs.ttl)
+	if element, ok := cs.entries[entry.key]; ok {
+		element.Value = entry
+		cs.order.MoveToFront(element)
+		return
+	}
+	cs.entries[entry.key] = cs.order.PushFront(entry)
+	for cs.order.Len() > cs.size {
+		oldest := cs.order.Back()
+		cs.order.Remove(oldest)
+		delete(cs.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Removes a key, and the keys under it if subtree is true
+func (cs *CachedStorage) invalidate(key string, subtree bool) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.generation++
+	for cachedKey, element := range cs.entries {
+		if cachedKey == key ||
+			(subtree && strings.HasPrefix(cachedKey, key+"/")) {
+			cs.order.Remove(element)
+			delete(cs.entries, cachedKey)
+		}
+	}
+}
+
+func (cs *CachedStorage) HasKey(key string) bool {
+	entry, generation := cs.get(key, false)
+	if entry != nil {
+		return entry.exists
+	}
+	exists := cs.backend.HasKey(key)
+	cs.put(&cacheEntry{key: key, exists: exists}, generation)
+	return exists
+}
+
+// Listings are not cached, since they change with the keys under them
+func (cs *CachedStorage) ListKeys(prefix string) []string {
+	return cs.backend.ListKeys(prefix)
+}
+
+func (cs *CachedStorage) Save(key string,
+	fields map[string]interface{}) error {
+	defer cs.invalidate(key, false)
+	return cs.backend.Save(key, fields)
+}
+
+func (cs *CachedStorage) Load(key string) (map[string]interface{},
+	error) {
+	var fields map[string]interface{}
+	entry, generation := cs.get(key, true)
+	if entry != nil && !entry.exists {
+		return fields, &NotExistError{key}
+	}
+	if entry != nil {
+		err := json.Unmarshal(entry.fieldsJson, &fields)
+		return fields, err
+	}
+	fields, err := cs.backend.Load(key)
+	if _, ok := err.(*NotExistError); ok {
+		cs.put(&cacheEntry{key: key}, generation)
+		return fields, err
+	}
+	if err != nil {
+		return fields, err
+	}
+	fieldsJson, err := json.Marshal(fields)
+	if err != nil {
+		return fields, err
+	}
+	cs.put(&cacheEntry{key: key, exists: true, fieldsJson: fieldsJson},
+		generation)
+	return fields, nil
+}
+
+func (cs *CachedStorage) Delete(key string) error {
+	defer cs.invalidate(key, true)
+	return cs.backend.Delete(key)
+}
+
+func (cs *CachedStorage) Stats() CacheStats {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	stats := CacheStats{Hits: cs.hits, Misses: cs.misses,
+		Size: cs.order.Len()}
+	if cs.hits+cs.misses > 0 {
+		stats.HitRate = float64(cs.hits) / float64(cs.hits+cs.misses)
+	}
+	return stats
+}
+
+// Handles the statistics of the storage cache for admins
+func getCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can see the cache statistics",
+			http.StatusForbidden)
+		return
+	}
+	cachedStorage, ok := storage.(*CachedStorage)
+	if !ok {
+		http.Error(w, "The storage cache is off", http.StatusNotFound)
+		return
+	}
+	statsJson, err := json.Marshal(cachedStorage.Stats())
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(statsJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCachedStorage(t *testing.T) {
+	backend := &InMemoryStorage{}
+	cachedStorage := NewCachedStorage(backend, CacheConfig{Size: 2})
+	err := cachedStorage.Init("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"p/project", "p/tasks/000000",
+		"p/tasks/000001"} {
+		err = cachedStorage.Save(key, map[string]interface{}{"Index": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a cached key is loaded without the backend
+	_, err = cachedStorage.Load("p/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.FailNthLoad(1)
+	fields, err := cachedStorage.Load("p/project")
+	if err != nil || fields["Index"] != 1.0 {
+		t.Fatal("expected a cache hit, got", fields, err)
+	}
+	fields["Index"] = 2
+	fields, _ = cachedStorage.Load("p/project")
+	if fields["Index"] != 1.0 {
+		t.Error("expected the cached fields to be unchanged, got", fields)
+	}
+	backend.FailNthLoad(0)
+
+	// a save replaces the cached fields
+	err = cachedStorage.Save("p/project", map[string]interface{}{"Index": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, _ = cachedStorage.Load("p/project")
+	if fields["Index"] != 3.0 {
+		t.Error("expected the saved fields, got", fields)
+	}
+
+	// the least recently used key is evicted
+	_, err = cachedStorage.Load("p/tasks/000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cachedStorage.Load("p/tasks/000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.FailNthLoad(1)
+	_, err = cachedStorage.Load("p/project")
+	if _, ok := err.(*InjectedFaultError); !ok {
+		t.Error("expected the evicted key to be loaded, got", err)
+	}
+
+	// deleting a key deletes the cached keys under it
+	err = cachedStorage.Delete("p/tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cachedStorage.Load("p/tasks/000001")
+	if _, ok := err.(*NotExistError); !ok {
+		t.Error("expected the deleted key to be missing, got", err)
+	}
+	if cachedStorage.HasKey("p/tasks/000001") {
+		t.Error("expected the missing key to be cached")
+	}
+
+	// expired keys are loaded again
+	cachedStorage.ttl = time.Millisecond
+	err = cachedStorage.Save("p/project", map[string]interface{}{"Index": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cachedStorage.Load("p/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	backend.FailNthLoad(1)
+	_, err = cachedStorage.Load("p/project")
+	if _, ok := err.(*InjectedFaultError); !ok {
+		t.Error("expected the expired key to be loaded, got", err)
+	}
+
+	stats := cachedStorage.Stats()
+	if stats.Hits != 3 || stats.Misses != 8 ||
+		stats.HitRate != 3.0/11.0 {
+		t.Error("wrong stats", stats)
+	}
+}
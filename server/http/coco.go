@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// number of line segments used to approximate a single bezier curve
+const bezierFlattenSteps = 10
+
+// CocoDataset is the top level structure of a COCO json file
+type CocoDataset struct {
+	Images      []CocoImage      `json:"images"`
+	Annotations []CocoAnnotation `json:"annotations"`
+	Categories  []CocoCategory   `json:"categories"`
+}
+
+// CocoImage describes a single image of a COCO dataset
+type CocoImage struct {
+	Id         int               `json:"id"`
+	FileName   string            `json:"file_name"`
+	CocoUrl    string            `json:"coco_url"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	VideoName  string            `json:"video_name,omitempty"`
+	Index      int               `json:"index"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// CocoAnnotation describes a single object instance of a COCO dataset
+type CocoAnnotation struct {
+	Id           int         `json:"id"`
+	ImageId      int         `json:"image_id"`
+	CategoryId   int         `json:"category_id"`
+	Segmentation [][]float64 `json:"segmentation,omitempty"`
+	Area         float64     `json:"area"`
+	Bbox         []float64   `json:"bbox"`
+	IsCrowd      int         `json:"iscrowd"`
+	// scalabel label attributes, not part of the COCO standard
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// CocoCategory describes a leaf category of a COCO dataset
+type CocoCategory struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name"`
+	Supercategory string `json:"supercategory"`
+}
+
+// corners of a box2d as exported by ParseBox2d
+type box2dCorners struct {
+	X1 float64 `json:"x1"`
+	Y1 float64 `json:"y1"`
+	X2 float64 `json:"x2"`
+	Y2 float64 `json:"y2"`
+}
+
+// Flattens the category tree into COCO categories. Only leaves get an id,
+// their direct parent is used as the supercategory. The returned map
+// resolves both the comma separated category path and the leaf name to an id.
+func flattenCocoCategories(categories []Category) ([]CocoCategory,
+	map[string]int) {
+	cocoCategories := []CocoCategory{}
+	categoryIds := map[string]int{}
+	var visit func(categories []Category, parents []string)
+	visit = func(categories []Category, parents []string) {
+		for _, category := range categories {
+			categoryPath := append(append([]string{}, parents...), category.Name)
+			if len(category.Subcategories) > 0 {
+				visit(category.Subcategories, categoryPath)
+				continue
+			}
+			supercategory := ""
+			if len(parents) > 0 {
+				supercategory = parents[len(parents)-1]
+			}
+			cocoCategory := CocoCategory{
+				Id:            len(cocoCategories) + 1,
+				Name:          category.Name,
+				Supercategory: supercategory,
+			}
+			cocoCategories = append(cocoCategories, cocoCategory)
+			categoryIds[strings.Join(categoryPath, ",")] = cocoCategory.Id
+			if _, ok := categoryIds[category.Name]; !ok {
+				categoryIds[category.Name] = cocoCategory.Id
+			}
+		}
+	}
+	visit(categories, []string{})
+	return cocoCategories, categoryIds
+}
+
+// Approximates a poly2d by a flat list of x, y coordinates. Bezier curves,
+// encoded as two 'C' control points between vertices, are sampled
+// into line segments.
+func flattenPoly2d(poly Poly2d) []float64 {
+	coordinates := []float64{}
+	numVertices := len(poly.Vertices)
+	if len(poly.Types) != numVertices {
+		Error.Printf("Poly2d has %d vertices but %d types",
+			numVertices, len(poly.Types))
+		return coordinates
+	}
+	for i := 0; i < numVertices; i++ {
+		if poly.Types[i] != 'C' {
+			coordinates = append(coordinates,
+				poly.Vertices[i][0], poly.Vertices[i][1])
+			continue
+		}
+		// a curve is made of the previous vertex, two control points
+		// and the following vertex, which wraps around for closed polygons
+		if i == 0 || i+1 >= numVertices || poly.Types[i+1] != 'C' {
+			Error.Printf("Invalid bezier curve in poly2d types %s", poly.Types)
+			return coordinates
+		}
+		start := poly.Vertices[i-1]
+		control1 := poly.Vertices[i]
+		control2 := poly.Vertices[i+1]
+		end := poly.Vertices[(i+2)%numVertices]
+		for step := 1; step < bezierFlattenSteps; step++ {
+			t := float64(step) / bezierFlattenSteps
+			for dim := 0; dim < 2; dim++ {
+				coordinates = append(coordinates,
+					math.Pow(1-t, 3)*start[dim]+
+						3*math.Pow(1-t, 2)*t*control1[dim]+
+						3*(1-t)*math.Pow(t, 2)*control2[dim]+
+						math.Pow(t, 3)*end[dim])
+			}
+		}
+		i++
+	}
+	return coordinates
+}
+
+// Computes the area of a closed polygon given as flat x, y coordinates
+func polygonArea(coordinates []float64) float64 {
+	area := 0.
+	numPoints := len(coordinates) / 2
+	for i := 0; i < numPoints; i++ {
+		j := (i + 1) % numPoints
+		area += coordinates[2*i]*coordinates[2*j+1] -
+			coordinates[2*j]*coordinates[2*i+1]
+	}
+	return math.Abs(area) / 2
+}
+
+// Computes the COCO bbox [x, y, width, height] enclosing the coordinates
+func coordinatesBbox(coordinates []float64) []float64 {
+	if len(coordinates) < 2 {
+		return []float64{0, 0, 0, 0}
+	}
+	minX, minY := coordinates[0], coordinates[1]
+	maxX, maxY := minX, minY
+	for i := 2; i+1 < len(coordinates); i += 2 {
+		minX = math.Min(minX, coordinates[i])
+		maxX = math.Max(maxX, coordinates[i])
+		minY = math.Min(minY, coordinates[i+1])
+		maxY = math.Max(maxY, coordinates[i+1])
+	}
+	return []float64{minX, minY, maxX - minX, maxY - minY}
+}
+
+// Converts an exported label into a COCO annotation. Returns false if the
+// label has no 2d shape that can be represented in COCO.
+func labelToCocoAnnotation(label LabelExport) (CocoAnnotation, bool) {
+	annotation := CocoAnnotation{}
+	if len(label.Poly2d) > 0 {
+		allCoordinates := []float64{}
+		for _, poly := range label.Poly2d {
+			coordinates := flattenPoly2d(poly)
+			if len(coordinates) == 0 {
+				continue
+			}
+			annotation.Segmentation = append(annotation.Segmentation,
+				coordinates)
+			allCoordinates = append(allCoordinates, coordinates...)
+			if poly.Closed {
+				annotation.Area += polygonArea(coordinates)
+			}
+		}
+		if len(annotation.Segmentation) == 0 {
+			return annotation, false
+		}
+		annotation.Bbox = coordinatesBbox(allCoordinates)
+	}
+	if label.Box2d != nil {
+		box := box2dCorners{}
+		MapToStruct(label.Box2d, &box)
+		annotation.Bbox = []float64{math.Min(box.X1, box.X2),
+			math.Min(box.Y1, box.Y2),
+			math.Abs(box.X2 - box.X1), math.Abs(box.Y2 - box.Y1)}
+		if len(annotation.Segmentation) == 0 {
+			annotation.Area = annotation.Bbox[2] * annotation.Bbox[3]
+		}
+	}
+	return annotation, annotation.Bbox != nil
+}
+
+// ExportCoco converts exported items into a COCO dataset. Category ids are
+// derived from the project's category tree.
+func ExportCoco(items []ItemExport, categories []Category) CocoDataset {
+	cocoCategories, categoryIds := flattenCocoCategories(categories)
+	dataset := CocoDataset{
+		Images:      []CocoImage{},
+		Annotations: []CocoAnnotation{},
+		Categories:  cocoCategories,
+	}
+	for _, item := range items {
+		image := CocoImage{
+			Id:         len(dataset.Images) + 1,
+			FileName:   item.Name,
+			CocoUrl:    item.Url,
+			VideoName:  item.VideoName,
+			Index:      item.Index,
+			Attributes: item.Attributes,
+		}
+		dataset.Images = append(dataset.Images, image)
+		for _, label := range item.Labels {
+			categoryId, ok := categoryIds[label.Category]
+			if !ok {
+				Warning.Printf("Skipping label %d of %s with unknown category %s",
+					label.Id, item.Url, label.Category)
+				continue
+			}
+			annotation, ok := labelToCocoAnnotation(label)
+			if !ok {
+				continue
+			}
+			annotation.Id = len(dataset.Annotations) + 1
+			annotation.ImageId = image.Id
+			annotation.CategoryId = categoryId
+			annotation.Attributes = label.Attributes
+			dataset.Annotations = append(dataset.Annotations, annotation)
+		}
+	}
+	return dataset
+}
+
+// COCO json format for 2d labels
+type cocoExporter struct{}
+
+func (cocoExporter) FileName(projectName string) string {
+	return fmt.Sprintf("%s_coco.json", projectName)
+}
+
+func (cocoExporter) Export(w io.Writer, project Project,
+	items []ItemExport) error {
+	exportJson, err := json.MarshalIndent(
+		ExportCoco(items, project.Options.Categories), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(exportJson)
+	return err
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var cocoTestCategories = []Category{
+	{"human", []Category{
+		{"person", nil},
+		{"rider", nil},
+	}},
+	{"car", nil},
+}
+
+func TestFlattenCocoCategories(t *testing.T) {
+	cocoCategories, categoryIds := flattenCocoCategories(cocoTestCategories)
+	expected := []CocoCategory{
+		{1, "person", "human"},
+		{2, "rider", "human"},
+		{3, "car", ""},
+	}
+	if !reflect.DeepEqual(cocoCategories, expected) {
+		t.Fatal("expected", expected, "got", cocoCategories)
+	}
+	for name, id := range map[string]int{
+		"human,person": 1, "rider": 2, "car": 3} {
+		if categoryIds[name] != id {
+			t.Error("expected", id, "for", name, "got", categoryIds[name])
+		}
+	}
+	if _, ok := categoryIds["human"]; ok {
+		t.Error("non-leaf category should not have an id")
+	}
+}
+
+func TestExportCocoBox2d(t *testing.T) {
+	items := []ItemExport{{
+		Name: "a.jpg",
+		Url:  "a.jpg",
+		Labels: []LabelExport{
+			{Id: 0, Category: "human,rider",
+				Box2d: ParseBox2d(Box2dDataStructs[0])},
+			{Id: 1, Category: "unknown",
+				Box2d: ParseBox2d(Box2dDataStructs[1])},
+		},
+	}}
+	dataset := ExportCoco(items, cocoTestCategories)
+	if len(dataset.Images) != 1 || len(dataset.Annotations) != 1 {
+		t.Fatal("expected 1 image and 1 annotation, got", dataset)
+	}
+	annotation := dataset.Annotations[0]
+	box := Box2dStructs[0]
+	expectedBbox := []float64{box[0], box[2], box[1] - box[0], box[3] - box[2]}
+	if !FloatArrayEqual(annotation.Bbox, expectedBbox) ||
+		len(annotation.Bbox) != 4 {
+		t.Error("expected", expectedBbox, "got", annotation.Bbox)
+	}
+	if annotation.CategoryId != 2 || annotation.ImageId != 1 {
+		t.Error("wrong ids in annotation", annotation)
+	}
+	if !FloatEqual(annotation.Area, expectedBbox[2]*expectedBbox[3]) {
+		t.Error("wrong area", annotation.Area)
+	}
+}
+
+func TestExportCocoPoly2d(t *testing.T) {
+	square := Poly2d{
+		Vertices: [][]float64{{0, 0}, {10, 0}, {10, 10}, {0, 10}},
+		Types:    "LLLL",
+		Closed:   true,
+	}
+	items := []ItemExport{{
+		Labels: []LabelExport{{Category: "car", Poly2d: []Poly2d{square}}},
+	}}
+	dataset := ExportCoco(items, cocoTestCategories)
+	if len(dataset.Annotations) != 1 {
+		t.Fatal("expected 1 annotation, got", dataset.Annotations)
+	}
+	annotation := dataset.Annotations[0]
+	if !FloatEqual(annotation.Area, 100) {
+		t.Error("expected area 100, got", annotation.Area)
+	}
+	if !FloatArrayEqual(annotation.Bbox, []float64{0, 0, 10, 10}) {
+		t.Error("expected bbox [0 0 10 10], got", annotation.Bbox)
+	}
+	if !FloatArrayEqual(annotation.Segmentation[0],
+		[]float64{0, 0, 10, 0, 10, 10, 0, 10}) {
+		t.Error("wrong segmentation", annotation.Segmentation)
+	}
+}
+
+func TestFlattenPoly2dBezier(t *testing.T) {
+	// control points on the straight line keep the curve on that line
+	poly := Poly2d{
+		Vertices: [][]float64{{0, 0}, {3, 0}, {6, 0}, {9, 0}},
+		Types:    "LCCL",
+		Closed:   false,
+	}
+	coordinates := flattenPoly2d(poly)
+	if len(coordinates) != 2*(bezierFlattenSteps+1) {
+		t.Fatal("wrong number of coordinates", coordinates)
+	}
+	for i := 0; i < len(coordinates); i += 2 {
+		if !FloatEqual(coordinates[i+1], 0) {
+			t.Error("point off the line", coordinates[i:i+2])
+		}
+		if i > 0 && coordinates[i] <= coordinates[i-2] {
+			t.Error("points are not ordered along the curve", coordinates)
+		}
+	}
+	// closed polygons wrap the last curve around to the first vertex
+	poly = Poly2d{
+		Vertices: [][]float64{{0, 0}, {9, 0}, {6, 0}, {3, 0}},
+		Types:    "LLCC",
+		Closed:   true,
+	}
+	coordinates = flattenPoly2d(poly)
+	if len(coordinates) != 2*(bezierFlattenSteps+1) {
+		t.Fatal("wrong number of coordinates", coordinates)
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// time allowed to write a message to a peer
+	collabWriteWait = 10 * time.Second
+	// peers which do not answer the pings in time are disconnected
+	collabPongWait   = 60 * time.Second
+	collabPingPeriod = (collabPongWait * 9) / 10
+	// messages queued for a peer, slower peers are disconnected
+	collabSendBuffer = 256
+	// messages queued for the saves of a room, the messages of a room with
+	// too many pending saves are rejected
+	collabSaveBuffer = 256
+)
+
+// Types of the messages of a collaboration session
+const (
+	// sent to a peer which joined a room, with its peer id, the latest
+	// revision of the task and the presence of the peers
+	CollabWelcome = "welcome"
+	// label actions, sent by a peer and pushed to all the peers of the room
+	// with the revision made by them
+	CollabAction = "action"
+	// item viewed by a peer, pushed to all the peers of the room with the
+	// presence of the peers
+	CollabPresence = "presence"
+	// the task was saved outside of the room, the peers have to reload it
+	CollabConflict = "conflict"
+	CollabError    = "error"
+)
+
+var collabUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// The item of a task viewed by a peer
+type Presence struct {
+	PeerId   string `json:"peerId"`
+	WorkerId string `json:"workerId"`
+	Item     int    `json:"item"`
+}
+
+// A message between a peer and the collaboration hub
+type CollabMessage struct {
+	Type     string        `json:"type"`
+	PeerId   string        `json:"peerId,omitempty"`
+	WorkerId string        `json:"workerId,omitempty"`
+	Revision int64         `json:"revision,omitempty"`
+	Item     int           `json:"item"`
+	Actions  []DeltaAction `json:"actions,omitempty"`
+	Peers    []Presence    `json:"peers,omitempty"`
+	Message  string        `json:"message,omitempty"`
+}
+
+// A connection of a labeling session to a room
+type CollabPeer struct {
+	hub         *CollabHub
+	conn        *websocket.Conn
+	send        chan CollabMessage
+	projectName string
+	taskId      string
+	// labeling session of the peer, its actions are only saved while the
+	// session holds the lock of the task
+	sessionId string
+	room      *CollabRoom
+	presence  Presence
+}
+
+// The peers labeling the same task. A room has a single writer: its peers
+// are the sessions of the worker who opened it, and their actions are saved
+// as delta saves of the sat of that worker, by the room apart from the hub.
+type CollabRoom struct {
+	ProjectName string
+	TaskId      string
+	// worker of the first peer, peers of other workers are rejected
+	WorkerId string
+	peers    map[*CollabPeer]bool
+	// joins and actions of the peers, answered in order by saveMessages
+	saves chan peerMessage
+}
+
+// A message received from a peer
+type peerMessage struct {
+	peer    *CollabPeer
+	message CollabMessage
+}
+
+// A message of a room to one of its peers, or to all of them
+type roomMessage struct {
+	room      *CollabRoom
+	peer      *CollabPeer
+	message   CollabMessage
+	broadcast bool
+	// the peer could not be welcomed and is disconnected
+	reject bool
+}
+
+// The hub keeps the peers of all the rooms and pushes the messages to them.
+// The rooms save the actions of their peers one at a time, so a slow save
+// only holds back the room of its task.
+type CollabHub struct {
+	registerPeer   chan *CollabPeer
+	unregisterPeer chan *CollabPeer
+	receive        chan peerMessage
+	saved          chan roomMessage
+	rooms          map[string]*CollabRoom
+}
+
+func newCollabHub() *CollabHub {
+	return &CollabHub{
+		registerPeer:   make(chan *CollabPeer),
+		unregisterPeer: make(chan *CollabPeer),
+		receive:        make(chan peerMessage),
+		saved:          make(chan roomMessage),
+		rooms:          make(map[string]*CollabRoom),
+	}
+}
+
+func (hub *CollabHub) run() {
+	for {
+		select {
+		case peer := <-hub.registerPeer:
+			hub.join(peer)
+		case peer := <-hub.unregisterPeer:
+			hub.leave(peer)
+		case received := <-hub.receive:
+			hub.handle(received.peer, received.message)
+		case saved := <-hub.saved:
+			hub.deliver(saved)
+		}
+	}
+}
+
+// Adds a peer to the room of its task, the room is opened by its first
+// peer. The peer is welcomed by the room with the latest revision. Peers of
+// another worker than the one of the room are rejected and disconnected,
+// since only the sat of that worker is saved.
+func (hub *CollabHub) join(peer *CollabPeer) {
+	key := path.Join(peer.projectName, peer.taskId)
+	room, ok := hub.rooms[key]
+	if !ok {
+		room = &CollabRoom{
+			ProjectName: peer.projectName,
+			TaskId:      peer.taskId,
+			WorkerId:    peer.presence.WorkerId,
+			peers:       map[*CollabPeer]bool{},
+			saves:       make(chan peerMessage, collabSaveBuffer),
+		}
+		hub.rooms[key] = room
+		go room.saveMessages(hub)
+	}
+	if peer.presence.WorkerId != room.WorkerId {
+		peer.send <- CollabMessage{Type: CollabError,
+			Message: "The task is labeled by another worker"}
+		close(peer.send)
+		return
+	}
+	room.peers[peer] = true
+	peer.room = room
+	hub.save(peer, CollabMessage{Type: CollabWelcome})
+}
+
+// Removes a peer from its room, the room is closed with its last peer
+func (hub *CollabHub) leave(peer *CollabPeer) {
+	room := peer.room
+	if room == nil || !room.peers[peer] {
+		return
+	}
+	delete(room.peers, peer)
+	close(peer.send)
+	if len(room.peers) == 0 {
+		delete(hub.rooms, path.Join(room.ProjectName, room.TaskId))
+		close(room.saves)
+		return
+	}
+	hub.broadcast(room, CollabMessage{Type: CollabPresence,
+		Peers: room.presence()})
+}
+
+// Queues a message of a peer for the saves of its room. Messages of a room
+// whose saves fall behind are rejected.
+func (hub *CollabHub) save(peer *CollabPeer, message CollabMessage) {
+	select {
+	case peer.room.saves <- peerMessage{peer, message}:
+	default:
+		hub.push(peer, CollabMessage{Type: CollabError,
+			Message: "Too many pending saves of the task"})
+	}
+}
+
+// Pushes a message of a room to its peers. A welcomed peer is presented to
+// the other peers of the room.
+func (hub *CollabHub) deliver(saved roomMessage) {
+	room := saved.room
+	if hub.rooms[path.Join(room.ProjectName, room.TaskId)] != room {
+		return
+	}
+	if saved.broadcast {
+		hub.broadcast(room, saved.message)
+		return
+	}
+	peer := saved.peer
+	if !room.peers[peer] {
+		return
+	}
+	if saved.reject {
+		hub.push(peer, saved.message)
+		hub.leave(peer)
+		return
+	}
+	if saved.message.Type != CollabWelcome {
+		hub.push(peer, saved.message)
+		return
+	}
+	saved.message.Peers = room.presence()
+	hub.push(peer, saved.message)
+	hub.broadcast(room, CollabMessage{Type: CollabPresence,
+		Peers: room.presence()})
+}
+
+// Queues a message to a peer. Peers too slow to take it are disconnected.
+func (hub *CollabHub) push(peer *CollabPeer, message CollabMessage) {
+	select {
+	case peer.send <- message:
+	default:
+		hub.leave(peer)
+	}
+}
+
+func (hub *CollabHub) broadcast(room *CollabRoom, message CollabMessage) {
+	for peer := range room.peers {
+		hub.push(peer, message)
+	}
+}
+
+// Queues the actions of a peer for the saves of its room, or updates the
+// presence of the peer
+func (hub *CollabHub) handle(peer *CollabPeer, message CollabMessage) {
+	room := peer.room
+	if room == nil || !room.peers[peer] {
+		return
+	}
+	switch message.Type {
+	case CollabPresence:
+		peer.presence.Item = message.Item
+		hub.broadcast(room, CollabMessage{Type: CollabPresence,
+			Peers: room.presence()})
+	case CollabAction:
+		hub.save(peer, message)
+	default:
+		hub.push(peer, CollabMessage{Type: CollabError,
+			Message: "Unknown message type " + message.Type})
+	}
+}
+
+// Answers the joins and saves the actions of the peers of a room in order,
+// until the room is closed. The actions of a peer are saved on the latest
+// revision of the task of the worker of the room and pushed to all the
+// peers. Actions of a session without the lock of the task are rejected.
+func (room *CollabRoom) saveMessages(hub *CollabHub) {
+	// latest revision of the task of the worker, loaded by the first message
+	var revision int64
+	loaded := false
+	for received := range room.saves {
+		peer := received.peer
+		if !loaded {
+			var err error
+			revision, err = latestRevision(room.ProjectName, room.TaskId,
+				room.WorkerId)
+			if err != nil {
+				Error.Println(err)
+				hub.saved <- roomMessage{room: room, peer: peer,
+					message: CollabMessage{Type: CollabError,
+						Message: err.Error()},
+					reject: received.message.Type == CollabWelcome}
+				continue
+			}
+			loaded = true
+		}
+		if received.message.Type == CollabWelcome {
+			hub.saved <- roomMessage{room: room, peer: peer,
+				message: CollabMessage{Type: CollabWelcome,
+					PeerId: peer.presence.PeerId, WorkerId: room.WorkerId,
+					Revision: revision}}
+			continue
+		}
+		actions := received.message.Actions
+		saved, err := SaveSatDelta(SatDelta{
+			ProjectName:  room.ProjectName,
+			TaskId:       room.TaskId,
+			WorkerId:     room.WorkerId,
+			SessionId:    peer.sessionId,
+			BaseRevision: revision,
+			Actions:      actions,
+		})
+		if conflict, ok := err.(*RevisionConflictError); ok {
+			revision = conflict.Latest
+			hub.saved <- roomMessage{room: room, broadcast: true,
+				message: CollabMessage{Type: CollabConflict,
+					WorkerId: room.WorkerId, Revision: conflict.Latest}}
+			continue
+		}
+		if err != nil {
+			if _, ok := err.(*TaskLockedError); !ok {
+				Error.Println(err)
+			}
+			hub.saved <- roomMessage{room: room, peer: peer,
+				message: CollabMessage{Type: CollabError,
+					Message: err.Error()}}
+			continue
+		}
+		revision = saved
+		hub.saved <- roomMessage{room: room, broadcast: true,
+			message: CollabMessage{Type: CollabAction,
+				PeerId: peer.presence.PeerId, WorkerId: room.WorkerId,
+				Revision: revision, Actions: actions}}
+	}
+}
+
+// Lists the presence of the peers of a room
+func (room *CollabRoom) presence() []Presence {
+	peers := []Presence{}
+	for peer := range room.peers {
+		peers = append(peers, peer.presence)
+	}
+	return peers
+}
+
+// Reads the messages of a peer until its connection is closed
+func (peer *CollabPeer) readMessages() {
+	defer func() {
+		peer.hub.unregisterPeer <- peer
+	}()
+	err := peer.conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	if err != nil {
+		Error.Println(err)
+		return
+	}
+	peer.conn.SetPongHandler(func(string) error {
+		return peer.conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+	for {
+		message := CollabMessage{}
+		err := peer.conn.ReadJSON(&message)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err,
+				websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				Error.Println(err)
+			}
+			return
+		}
+		peer.hub.receive <- peerMessage{peer, message}
+	}
+}
+
+// Writes the messages queued for a peer and pings it, the connection is
+// closed when the hub stops sending to the peer
+func (peer *CollabPeer) writeMessages() {
+	ticker := time.NewTicker(collabPingPeriod)
+	defer func() {
+		ticker.Stop()
+		peer.conn.Close()
+	}()
+	for {
+		select {
+		case message, ok := <-peer.send:
+			err := peer.conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err != nil {
+				Error.Println(err)
+				return
+			}
+			if !ok {
+				err = peer.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				if err != nil {
+					Error.Println(err)
+				}
+				return
+			}
+			err = peer.conn.WriteJSON(message)
+			if err != nil {
+				Error.Println(err)
+				return
+			}
+		case <-ticker.C:
+			err := peer.conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err == nil {
+				err = peer.conn.WriteMessage(websocket.PingMessage, nil)
+			}
+			if err != nil {
+				Error.Println(err)
+				return
+			}
+		}
+	}
+}
+
+// Handles the websocket connections of the labeling sessions joining the
+// room of a task
+func collabHandler(hub *CollabHub, w http.ResponseWriter, r *http.Request) {
+	taskIndex, err := strconv.Atoi(r.FormValue("task_index"))
+	if err != nil {
+		http.Error(w, "Invalid task_index", http.StatusBadRequest)
+		return
+	}
+	projectName := r.FormValue("project_name")
+	if !canOpenTask(r, projectName, taskIndex) {
+		http.Error(w, "The task is claimed by another worker",
+			http.StatusForbidden)
+		return
+	}
+	conn, err := collabUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		Error.Println(err)
+		return
+	}
+	peer := &CollabPeer{
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan CollabMessage, collabSendBuffer),
+		projectName: projectName,
+		taskId:      Index2str(taskIndex),
+		sessionId:   r.FormValue("session_id"),
+		presence:    Presence{PeerId: getUuidV4(), WorkerId: getWorkerId(r)},
+	}
+	hub.registerPeer <- peer
+	go peer.writeMessages()
+	go peer.readMessages()
+}
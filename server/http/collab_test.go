@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const collabTestProject = "scalabel_collab_test"
+
+// Connects a peer to the room of the first task and reads its welcome
+func joinTestRoom(t *testing.T, server *httptest.Server) (*websocket.Conn,
+	CollabMessage) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") +
+		"/collab?project_name=" + collabTestProject + "&task_index=0"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	welcome := readTestMessage(t, conn, CollabWelcome)
+	return conn, welcome
+}
+
+// Reads the messages of a peer until a message of the given type
+func readTestMessage(t *testing.T, conn *websocket.Conn,
+	messageType string) CollabMessage {
+	err := conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		message := CollabMessage{}
+		err := conn.ReadJSON(&message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+func TestCollabRoom(t *testing.T) {
+	_, tasks := saveTestProject(t, collabTestProject,
+		[][]Item{{{Url: "a.jpg"}}}, nil)
+	assignment := Assignment{Task: tasks[0], WorkerId: DefaultWorker,
+		StartTime: 5}
+	saveTestKey(t, assignment.GetKey(), assignment.GetFields())
+	defer deleteTestProject(t, collabTestProject)
+	hub := newCollabHub()
+	go hub.run()
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			collabHandler(hub, w, r)
+		}))
+	defer server.Close()
+
+	alice, welcome := joinTestRoom(t, server)
+	defer alice.Close()
+	if welcome.Revision != 5 || welcome.WorkerId != DefaultWorker {
+		t.Error("wrong welcome", welcome)
+	}
+	bob, bobWelcome := joinTestRoom(t, server)
+	defer bob.Close()
+	// alice is told about her own join first
+	readTestMessage(t, alice, CollabPresence)
+	presence := readTestMessage(t, alice, CollabPresence)
+	if len(presence.Peers) != 2 {
+		t.Error("expected the presence of both peers, got", presence.Peers)
+	}
+
+	// the actions of a peer are saved and pushed to every peer
+	err := alice.WriteJSON(CollabMessage{Type: CollabAction,
+		Actions: []DeltaAction{{Type: DeltaUpdateLabel,
+			Label: &LabelData{Id: 1, Category: []int{0}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	action := readTestMessage(t, bob, CollabAction)
+	if action.PeerId != welcome.PeerId || action.Revision <= 5 ||
+		len(action.Actions) != 1 {
+		t.Error("wrong pushed action", action)
+	}
+	readTestMessage(t, alice, CollabAction)
+	sat, err := GetSat(collabTestProject, Index2str(0), DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sat.Revision != action.Revision || len(sat.Task.Items[0].Labels) != 1 {
+		t.Error("expected the action to be saved, got", sat.Task)
+	}
+
+	// actions of sessions without the lock of the task are not saved
+	_, acquired, err := AcquireTaskLock(collabTestProject, 0, DefaultWorker,
+		"collab_test_session")
+	if err != nil || !acquired {
+		t.Fatal("expected to lock the task", err)
+	}
+	err = alice.WriteJSON(CollabMessage{Type: CollabAction,
+		Actions: []DeltaAction{{Type: DeltaDeleteLabel, Id: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := readTestMessage(t, alice, CollabError)
+	if !strings.Contains(rejected.Message, "locked") {
+		t.Error("expected the action to be rejected by the lock, got",
+			rejected.Message)
+	}
+	err = ForceUnlockTask(collabTestProject, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bob.WriteJSON(CollabMessage{Type: CollabPresence, Item: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	presence = readTestMessage(t, alice, CollabPresence)
+	items := map[string]int{}
+	for _, peer := range presence.Peers {
+		items[peer.PeerId] = peer.Item
+	}
+	if len(items) != 2 || items[welcome.PeerId] != 0 ||
+		items[bobWelcome.PeerId] != 3 {
+		t.Error("wrong presence", presence.Peers)
+	}
+
+	// a peer leaving updates the presence of the others
+	bob.Close()
+	presence = readTestMessage(t, alice, CollabPresence)
+	if len(presence.Peers) != 1 {
+		t.Error("expected only alice to be present, got", presence.Peers)
+	}
+}
+
+func TestCollabOtherWorker(t *testing.T) {
+	saveTestProject(t, collabTestProject, [][]Item{{{Url: "a.jpg"}}},
+		[]testSubmission{{workerId: "alice"}, {workerId: "bob"}})
+	defer deleteTestProject(t, collabTestProject)
+	hub := newCollabHub()
+	go hub.run()
+	joinPeer := func(workerId string) *CollabPeer {
+		peer := &CollabPeer{hub: hub,
+			send:        make(chan CollabMessage, collabSendBuffer),
+			projectName: collabTestProject, taskId: Index2str(0),
+			presence: Presence{PeerId: workerId, WorkerId: workerId}}
+		hub.registerPeer <- peer
+		return peer
+	}
+
+	alice := joinPeer("alice")
+	if message := <-alice.send; message.Type != CollabWelcome {
+		t.Error("expected alice to be welcomed, got", message)
+	}
+	// the room only saves the sat of alice, so bob is rejected
+	bob := joinPeer("bob")
+	if message := <-bob.send; message.Type != CollabError {
+		t.Error("expected bob to be rejected, got", message)
+	}
+	if _, ok := <-bob.send; ok {
+		t.Error("expected bob to be disconnected")
+	}
+	hub.unregisterPeer <- alice
+}
+
+func TestCollabClaimedTask(t *testing.T) {
+	userManagement := env.UserManagement
+	env.UserManagement = "on"
+	claim := TaskClaim{ProjectName: collabTestProject, TaskIndex: 0,
+		AssignedTo: "collab_test_user"}
+	err := storage.Save(claim.GetKey(), claim.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		env.UserManagement = userManagement
+		deleteTestProject(t, collabTestProject)
+	}()
+	hub := newCollabHub()
+	go hub.run()
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			collabHandler(hub, w, r)
+		}))
+	defer server.Close()
+
+	// workers may only join the rooms of the tasks they may open
+	url := "ws" + strings.TrimPrefix(server.URL, "http") +
+		"/collab?project_name=" + collabTestProject + "&task_index=0"
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || response == nil ||
+		response.StatusCode != http.StatusForbidden {
+		t.Error("expected the room of a task assigned to another worker to " +
+			"be forbidden")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// default number of workers who have to vote for a merged label, which
+// discards the labels of a single worker
+const defaultMinVotes = 2
+
+// Labels of different workers describing the same object
+type labelCluster struct {
+	// labels by the index of their worker
+	labels  map[int]LabelExport
+	workers []int
+}
+
+func (cluster *labelCluster) add(worker int, label LabelExport) {
+	cluster.labels[worker] = label
+	cluster.workers = append(cluster.workers, worker)
+}
+
+// Mean IoU of a label with the labels of a cluster. Returns false if the
+// label does not belong to the cluster.
+func (cluster *labelCluster) match(label LabelExport) (float64, bool) {
+	total := 0.0
+	for _, worker := range cluster.workers {
+		iou, ok := labelIoU(cluster.labels[worker], label)
+		if !ok {
+			if cluster.labels[worker].Category != label.Category {
+				return 0, false
+			}
+			iou = 1
+		}
+		total += iou
+	}
+	iou := total / float64(len(cluster.workers))
+	return iou, iou >= agreementMatchIoU
+}
+
+// Wraps the export of a task to merge the submissions of all the workers.
+// Labels are clustered by IoU across workers, and each cluster with enough
+// votes becomes a label with the majority category and attribute values.
+// Tasks without submissions are exported by exportTask.
+func consensusTaskItems(exportTask exportTaskFunc) exportTaskFunc {
+	return func(project Project, task Task, filter ExportFilter) []ItemExport {
+		workers, workerItems := exportWorkerItems(project, task, filter,
+			exportTask)
+		if len(workers) == 0 {
+			filter.Consensus = false
+			return exportTask(project, task, filter)
+		}
+		// the labels of a task with fewer workers than the votes needed are
+		// all discarded
+		minVotes := Max(filter.MinVotes, 1)
+		items := []ItemExport{}
+		for i, item := range workerItems[0] {
+			workerItem := []ItemExport{}
+			for _, itemsOfWorker := range workerItems {
+				if i < len(itemsOfWorker) {
+					workerItem = append(workerItem, itemsOfWorker[i])
+				}
+			}
+			item.Attributes = voteItemAttributes(workerItem)
+			item.Labels = mergeLabels(workerItem, len(workers), minVotes)
+			items = append(items, item)
+		}
+		return items
+	}
+}
+
+// Merges the labels of an item by several workers
+func mergeLabels(workerItem []ItemExport, numWorkers int,
+	minVotes int) []LabelExport {
+	clusters := []*labelCluster{}
+	for worker, item := range workerItem {
+		for _, label := range item.Labels {
+			var best *labelCluster
+			bestIoU := 0.0
+			for _, cluster := range clusters {
+				if _, ok := cluster.labels[worker]; ok {
+					continue
+				}
+				if iou, ok := cluster.match(label); ok && iou > bestIoU {
+					best, bestIoU = cluster, iou
+				}
+			}
+			if best == nil {
+				best = &labelCluster{labels: map[int]LabelExport{}}
+				clusters = append(clusters, best)
+			}
+			best.add(worker, label)
+		}
+	}
+	labels := []LabelExport{}
+	// labels of different workers may have the same id
+	usedIds := map[int]bool{}
+	nextId := 0
+	for _, cluster := range clusters {
+		if len(cluster.workers) < minVotes {
+			continue
+		}
+		label := cluster.merge(numWorkers)
+		for usedIds[label.Id] {
+			label.Id = nextId
+			nextId++
+		}
+		usedIds[label.Id] = true
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// Merges the labels of a cluster. The shape of a box is the mean of the
+// boxes, other shapes are taken from the label closest to the others.
+func (cluster *labelCluster) merge(numWorkers int) LabelExport {
+	members := []LabelExport{}
+	for _, worker := range cluster.workers {
+		members = append(members, cluster.labels[worker])
+	}
+	label := members[medoid(members)]
+	categories := []interface{}{}
+	for _, member := range members {
+		categories = append(categories, member.Category)
+	}
+	label.Category = majorityValue(categories).(string)
+	label.Attributes = map[string]interface{}{}
+	for _, key := range attributeKeys(members) {
+		values := []interface{}{}
+		for _, member := range members {
+			if value, ok := member.Attributes[key]; ok {
+				values = append(values, value)
+			}
+		}
+		// an attribute is kept if most workers set it
+		if len(values)*2 > len(members) {
+			label.Attributes[key] = majorityValue(values)
+		}
+	}
+	if len(label.Box2d) > 0 {
+		box := map[string]interface{}{}
+		for _, key := range []string{"x1", "y1", "x2", "y2"} {
+			sum := 0.0
+			for _, member := range members {
+				sum += shapeNumber(member.Box2d, key)
+			}
+			box[key] = sum / float64(len(members))
+		}
+		label.Box2d = box
+	}
+	label.Confidence = float64(len(members)) / float64(numWorkers)
+	return label
+}
+
+// Finds the label with the highest IoU with the other labels
+func medoid(labels []LabelExport) int {
+	best := 0
+	bestIoU := -1.0
+	for i, label := range labels {
+		total := 0.0
+		for j, other := range labels {
+			if iou, ok := labelIoU(label, other); ok && i != j {
+				total += iou
+			}
+		}
+		if total > bestIoU {
+			best, bestIoU = i, total
+		}
+	}
+	return best
+}
+
+// Lists the attribute names of labels in order
+func attributeKeys(labels []LabelExport) []string {
+	keys := []string{}
+	found := map[string]bool{}
+	for _, label := range labels {
+		for key := range label.Attributes {
+			if !found[key] {
+				found[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Finds the value with the most votes. Ties go to the value voted first.
+func majorityValue(values []interface{}) interface{} {
+	votes := map[string]int{}
+	for _, value := range values {
+		votes[fmt.Sprint(value)]++
+	}
+	var majority interface{}
+	maxVotes := 0
+	for _, value := range values {
+		if count := votes[fmt.Sprint(value)]; count > maxVotes {
+			majority, maxVotes = value, count
+		}
+	}
+	return majority
+}
+
+// Votes on the attributes of an item by several workers
+func voteItemAttributes(workerItem []ItemExport) map[string]string {
+	keys := []string{}
+	found := map[string]bool{}
+	for _, item := range workerItem {
+		for key := range item.Attributes {
+			if !found[key] {
+				found[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return workerItem[0].Attributes
+	}
+	sort.Strings(keys)
+	attributes := map[string]string{}
+	for _, key := range keys {
+		values := []interface{}{}
+		for _, item := range workerItem {
+			if value, ok := item.Attributes[key]; ok {
+				values = append(values, value)
+			}
+		}
+		if len(values)*2 > len(workerItem) {
+			attributes[key] = majorityValue(values).(string)
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"path"
+	"testing"
+)
+
+func TestMergeLabels(t *testing.T) {
+	box := func(x float64) map[string]interface{} {
+		return map[string]interface{}{"x1": x, "y1": 0.0, "x2": x + 10,
+			"y2": 10.0}
+	}
+	workerItem := []ItemExport{
+		{Labels: []LabelExport{
+			{Id: 0, Category: "car", Box2d: box(0),
+				Attributes: map[string]interface{}{"occluded": true}},
+			{Id: 1, Category: "person", Box2d: box(100)},
+		}},
+		{Labels: []LabelExport{
+			{Id: 0, Category: "car", Box2d: box(2),
+				Attributes: map[string]interface{}{"occluded": false}},
+		}},
+		{Labels: []LabelExport{
+			{Id: 0, Category: "truck", Box2d: box(1),
+				Attributes: map[string]interface{}{"occluded": true}},
+			{Id: 1, Category: "person", Box2d: box(50)},
+		}},
+	}
+	labels := mergeLabels(workerItem, 3, 2)
+	if len(labels) != 1 {
+		t.Fatal("expected the singletons to be discarded, got", labels)
+	}
+	label := labels[0]
+	if label.Category != "car" || label.Attributes["occluded"] != true ||
+		math.Abs(label.Confidence-1) > 1e-9 ||
+		shapeNumber(label.Box2d, "x1") != 1 {
+		t.Error("wrong merged label", label)
+	}
+	if labels = mergeLabels(workerItem, 3, 1); len(labels) != 3 {
+		t.Error("expected every cluster with a single vote, got", labels)
+	} else if labels[1].Id == labels[2].Id {
+		t.Error("expected merged labels to have different ids", labels)
+	}
+}
+
+func TestConsensusExport(t *testing.T) {
+	project := saveAgreementTestSubmissions(t)
+	defer deleteTestProject(t, agreementTestProject)
+	filter, err := parseExportFilter(func(key string) string {
+		return map[string]string{"consensus": "true"}[key]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := GetTasksInProject(agreementTestProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := collectItems(exportTaskStream(project, tasks, filter,
+		exportTaskItems))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || len(items[0].Labels) != 1 {
+		t.Fatal("expected the box of alice and bob, got", items)
+	}
+	label := items[0].Labels[0]
+	if math.Abs(label.Confidence-2.0/3) > 1e-9 ||
+		shapeNumber(label.Box2d, "x1") != 0.5 ||
+		label.Attributes["occluded"] != false {
+		t.Error("wrong merged label", label)
+	}
+	filter.MinVotes = 1
+	items, err = collectItems(exportTaskStream(project, tasks, filter,
+		exportTaskItems))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || len(items[0].Labels) != 2 {
+		t.Error("expected the box of carol too, got", items)
+	}
+
+	// the box of a single worker does not get enough votes
+	for _, workerId := range []string{"bob", "carol"} {
+		for _, folder := range []string{"assignments", "submissions"} {
+			err = storage.Delete(path.Join(agreementTestProject, folder,
+				Index2str(0), workerId))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	filter.MinVotes = defaultMinVotes
+	items, err = collectItems(exportTaskStream(project, tasks, filter,
+		exportTaskItems))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || len(items[0].Labels) != 0 {
+		t.Error("expected the box of alice to be discarded, got", items)
+	}
+	filter.MinVotes = 1
+	items, err = collectItems(exportTaskStream(project, tasks, filter,
+		exportTaskItems))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || len(items[0].Labels) != 1 {
+		t.Error("expected the box of alice with one vote, got", items)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// default number of delta saves after which a full snapshot is saved
+const defaultSnapshotDeltas = 20
+
+// Types of the changes of a delta save
+const (
+	DeltaUpdateLabel = "updateLabel"
+	DeltaDeleteLabel = "deleteLabel"
+	DeltaUpdateShape = "updateShape"
+	DeltaDeleteShape = "deleteShape"
+	DeltaUpdateTrack = "updateTrack"
+	DeltaDeleteTrack = "deleteTrack"
+)
+
+// A change of a label, a shape or a track
+type DeltaAction struct {
+	Type string `json:"type" yaml:"type"`
+	// index of the item of the label or shape
+	Item int `json:"item" yaml:"item"`
+	// id of the deleted label, shape or track, or of the updated track
+	Id    int         `json:"id" yaml:"id"`
+	Label *LabelData  `json:"label,omitempty" yaml:"label,omitempty"`
+	Shape *ShapeData  `json:"shape,omitempty" yaml:"shape,omitempty"`
+	Track interface{} `json:"track,omitempty" yaml:"track,omitempty"`
+}
+
+//implements Serializable
+type SatDelta struct {
+	ProjectName string `json:"projectName" yaml:"projectName"`
+	TaskId      string `json:"taskId" yaml:"taskId"`
+	WorkerId    string `json:"workerId" yaml:"workerId"`
+	// submit time of the revision the changes are based on
+	BaseRevision int64 `json:"baseRevision" yaml:"baseRevision"`
+	// submit time of the revision made by the changes
+	SubmitTime int64         `json:"submitTime" yaml:"submitTime"`
+	Actions    []DeltaAction `json:"actions" yaml:"actions"`
+	// labeling session making the changes, which is not saved
+	SessionId string `json:"sessionId" yaml:"sessionId"`
+}
+
+func (delta *SatDelta) GetKey() string {
+	return path.Join(delta.ProjectName, "deltas", delta.TaskId,
+		delta.WorkerId, strconv.FormatInt(delta.SubmitTime, 10))
+}
+
+func (delta *SatDelta) GetFields() map[string]interface{} {
+	return map[string]interface{}{
+		"projectName":  delta.ProjectName,
+		"taskId":       delta.TaskId,
+		"workerId":     delta.WorkerId,
+		"baseRevision": delta.BaseRevision,
+		"submitTime":   delta.SubmitTime,
+		"actions":      delta.Actions,
+	}
+}
+
+// Number of delta saves after which a full snapshot is saved
+func snapshotDeltas() int {
+	if env.SnapshotDeltas > 0 {
+		return env.SnapshotDeltas
+	}
+	return defaultSnapshotDeltas
+}
+
+// Applies a change to the data of a task
+func (action DeltaAction) apply(task *TaskData) error {
+	if action.Type == DeltaUpdateTrack || action.Type == DeltaDeleteTrack {
+		if task.Tracks == nil {
+			task.Tracks = TrackMap{}
+		}
+		if action.Type == DeltaUpdateTrack {
+			task.Tracks[action.Id] = action.Track
+		} else {
+			delete(task.Tracks, action.Id)
+		}
+		return nil
+	}
+	if action.Item < 0 || action.Item >= len(task.Items) {
+		return fmt.Errorf("Item %d does not exist", action.Item)
+	}
+	item := &task.Items[action.Item]
+	if item.Labels == nil {
+		item.Labels = map[int]LabelData{}
+	}
+	if item.Shapes == nil {
+		item.Shapes = map[int]ShapeData{}
+	}
+	switch action.Type {
+	case DeltaUpdateLabel:
+		if action.Label == nil {
+			return fmt.Errorf("Missing label of %s", action.Type)
+		}
+		item.Labels[action.Label.Id] = *action.Label
+		task.Status.MaxLabelId = Max(task.Status.MaxLabelId, action.Label.Id)
+		task.Status.MaxOrder = Max(task.Status.MaxOrder, action.Label.Order)
+	case DeltaDeleteLabel:
+		delete(item.Labels, action.Id)
+	case DeltaUpdateShape:
+		if action.Shape == nil {
+			return fmt.Errorf("Missing shape of %s", action.Type)
+		}
+		item.Shapes[action.Shape.Id] = *action.Shape
+		task.Status.MaxShapeId = Max(task.Status.MaxShapeId, action.Shape.Id)
+	case DeltaDeleteShape:
+		delete(item.Shapes, action.Id)
+	default:
+		return fmt.Errorf("Unknown change %s", action.Type)
+	}
+	return nil
+}
+
+// Lists the keys of the delta saves of a worker on a task. The delta saves
+// are kept after a snapshot, so that every revision can be loaded again.
+func listDeltaKeys(projectName string, taskIndex string,
+	workerId string) []string {
+	return listTimeKeys(path.Join(projectName, "deltas", taskIndex, workerId))
+}
+
+// Applies the delta saves made after the snapshot of a sat. The submit time
+// of the sat becomes the time of the latest delta save.
+func applyPendingDeltas(sat *Sat, projectName string, taskIndex string,
+	workerId string) error {
+	return applyDeltasUntil(sat, projectName, taskIndex, workerId,
+		math.MaxInt64)
+}
+
+// Applies the delta saves made after the snapshot of a sat up to a submit
+// time
+func applyDeltasUntil(sat *Sat, projectName string, taskIndex string,
+	workerId string, until int64) error {
+	for _, key := range listDeltaKeys(projectName, taskIndex, workerId) {
+		submitTime, err := strconv.ParseInt(path.Base(key), 10, 64)
+		if err != nil || submitTime <= sat.Task.Config.SubmitTime ||
+			submitTime > until {
+			continue
+		}
+		fields, err := storage.Load(key)
+		if err != nil {
+			return err
+		}
+		delta := SatDelta{}
+		deltaJson, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(deltaJson, &delta)
+		if err != nil {
+			return err
+		}
+		for _, action := range delta.Actions {
+			err = action.apply(&sat.Task)
+			if err != nil {
+				return err
+			}
+		}
+		sat.Task.Config.SubmitTime = submitTime
+	}
+	return nil
+}
+
+// Applies the changes of a delta save of a worker to the latest revision of
+// the task. The changes are rejected with a TaskLockedError if another
+// session holds the lock of the task, and with a RevisionConflictError if
+// they are not based on the latest revision. A full snapshot is saved for
+// the first delta save and then after every snapshotDeltas delta saves, the
+// other saves only store their changes. A snapshot is only the base of the
+// later revisions, the delta saves before it are kept as history. Returns
+// the new revision.
+func SaveSatDelta(delta SatDelta) (int64, error) {
+	taskIndex, err := strconv.Atoi(delta.TaskId)
+	if err != nil {
+		return 0, err
+	}
+	err = checkTaskLock(delta.ProjectName, taskIndex, delta.WorkerId,
+		delta.SessionId)
+	if err != nil {
+		return 0, err
+	}
+	unlock := lockTaskSaves(delta.ProjectName, delta.TaskId, delta.WorkerId)
+	defer unlock()
+	sat, err := GetSat(delta.ProjectName, delta.TaskId, delta.WorkerId)
+	if err != nil {
+		return 0, err
+	}
+	latest := sat.Revision
+	if delta.BaseRevision != latest {
+		return latest, &RevisionConflictError{latest}
+	}
+	for _, action := range delta.Actions {
+		err = action.apply(&sat.Task)
+		if err != nil {
+			return latest, err
+		}
+	}
+	delta.SubmitTime = nextRevisionTime(latest)
+	sat.Task.Config.SubmitTime = delta.SubmitTime
+	sat.User.UserId = delta.WorkerId
+	revision := satRevision(sat)
+	snapshotTime := latestSnapshotTime(delta.ProjectName, delta.TaskId,
+		delta.WorkerId)
+	if snapshotTime > 0 && countDeltasAfter(delta.ProjectName, delta.TaskId,
+		delta.WorkerId, snapshotTime)+1 < snapshotDeltas() {
+		err = storage.Save(delta.GetKey(), delta.GetFields())
+		if err != nil {
+			return latest, err
+		}
+		revision.Delta = true
+		saveRevisionSummary(delta.ProjectName, delta.TaskId, revision)
+		return delta.SubmitTime, nil
+	}
+	err = storage.Save(sat.GetKey(), sat.GetFields())
+	if err != nil {
+		return latest, err
+	}
+	saveRevisionSummary(delta.ProjectName, delta.TaskId, revision)
+	return delta.SubmitTime, nil
+}
+
+// Gets the submit time of the latest snapshot of the task of a worker, or 0
+// if the worker has no snapshot of the task
+func latestSnapshotTime(projectName string, taskIndex string,
+	workerId string) int64 {
+	keys := listSubmissionKeys(projectName, taskIndex, workerId)
+	if len(keys) == 0 {
+		return 0
+	}
+	submitTime, err := strconv.ParseInt(path.Base(keys[len(keys)-1]), 10, 64)
+	if err != nil {
+		Error.Println(err)
+	}
+	return submitTime
+}
+
+// Counts the delta saves of the task of a worker made after a submit time
+func countDeltasAfter(projectName string, taskIndex string, workerId string,
+	after int64) int {
+	count := 0
+	for _, key := range listDeltaKeys(projectName, taskIndex, workerId) {
+		submitTime, err := strconv.ParseInt(path.Base(key), 10, 64)
+		if err == nil && submitTime > after {
+			count++
+		}
+	}
+	return count
+}
+
+// Handles the delta saves of sats. A save based on an older revision gets
+// the latest revision with a conflict status.
+func postSaveDeltaV2Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		Error.Println(err)
+	}
+	delta := SatDelta{}
+	err = json.Unmarshal(body, &delta)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// workers can only save their own sats
+	delta.WorkerId = getWorkerId(r)
+	revision, err := SaveSatDelta(delta)
+	if writeRevisionConflict(w, err) || writeTaskLocked(w, err) {
+		return
+	}
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeRevisionResponse(w, SaveResponse{revision})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const deltaTestProject = "scalabel_delta_test"
+
+// Posts a delta save and returns the status and the revision of the response
+func postTestDelta(t *testing.T, delta SatDelta) (int, int64) {
+	deltaJson, err := json.Marshal(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "postSaveDeltaV2",
+		bytes.NewReader(deltaJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	postSaveDeltaV2Handler(rr, req)
+	response := SaveResponse{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err, rr.Body.String())
+	}
+	return rr.Code, response.Revision
+}
+
+func TestSaveSatDelta(t *testing.T) {
+	saveTestProject(t, deltaTestProject, [][]Item{{{Url: "a.jpg"}}},
+		[]testSubmission{{workerId: DefaultWorker}})
+	snapshots := env.SnapshotDeltas
+	env.SnapshotDeltas = 2
+	defer func() {
+		env.SnapshotDeltas = snapshots
+		deleteTestProject(t, deltaTestProject)
+	}()
+	sat, err := GetSat(deltaTestProject, Index2str(0), DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first delta save is a snapshot
+	box := map[string]interface{}{"x1": 0, "y1": 0, "x2": 10, "y2": 10}
+	delta := SatDelta{ProjectName: deltaTestProject, TaskId: Index2str(0),
+		BaseRevision: sat.Task.Config.SubmitTime, Actions: []DeltaAction{
+			{Type: DeltaUpdateLabel, Label: &LabelData{Id: 3,
+				Category: []int{0}, Shapes: []int{2}}},
+			{Type: DeltaUpdateShape, Shape: &ShapeData{Id: 2, Label: []int{3},
+				Type: "rect", Shape: box}},
+		}}
+	code, first := postTestDelta(t, delta)
+	if code != 200 {
+		t.Fatal("Delta save handler HTTP code:", code)
+	}
+	if len(listSubmissionKeys(deltaTestProject, Index2str(0),
+		DefaultWorker)) != 1 {
+		t.Error("expected a snapshot of the first delta save")
+	}
+
+	// the next delta save only stores its changes
+	delta.BaseRevision = first
+	delta.Actions = []DeltaAction{{Type: DeltaUpdateLabel,
+		Label: &LabelData{Id: 3, Category: []int{1}, Shapes: []int{2}}}}
+	code, second := postTestDelta(t, delta)
+	if code != 200 || second <= first {
+		t.Fatal("wrong delta save", code, second)
+	}
+	if len(listDeltaKeys(deltaTestProject, Index2str(0), DefaultWorker)) != 1 {
+		t.Error("expected the changes to be saved as a delta")
+	}
+	sat, err = GetSat(deltaTestProject, Index2str(0), DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	label := sat.Task.Items[0].Labels[3]
+	if sat.Task.Config.SubmitTime != second || len(label.Category) != 1 ||
+		label.Category[0] != 1 || len(sat.Task.Items[0].Shapes) != 1 ||
+		sat.Task.Status.MaxLabelId != 3 || sat.Task.Status.MaxShapeId != 2 {
+		t.Error("wrong latest task", sat.Task)
+	}
+
+	// changes based on an older revision are rejected
+	delta.BaseRevision = first
+	delta.Actions = []DeltaAction{{Type: DeltaDeleteLabel, Id: 3}}
+	code, latest := postTestDelta(t, delta)
+	if code != http.StatusConflict || latest != second {
+		t.Error("expected a conflict with the latest revision", code, latest)
+	}
+
+	// a snapshot is saved after snapshotDeltas saves, the deltas are kept
+	delta.BaseRevision = second
+	code, third := postTestDelta(t, delta)
+	if code != 200 {
+		t.Fatal("Delta save handler HTTP code:", code)
+	}
+	if len(listDeltaKeys(deltaTestProject, Index2str(0), DefaultWorker)) != 1 ||
+		len(listSubmissionKeys(deltaTestProject, Index2str(0),
+			DefaultWorker)) != 2 {
+		t.Error("expected a snapshot after the kept delta")
+	}
+	sat, err = GetSat(deltaTestProject, Index2str(0), DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sat.Task.Items[0].Labels) != 0 {
+		t.Error("expected the label to be deleted", sat.Task.Items[0].Labels)
+	}
+
+	// the delta saves after the snapshot are counted from it
+	delta.BaseRevision = third
+	delta.Actions = []DeltaAction{{Type: DeltaUpdateTrack, Id: 1,
+		Track: map[string]interface{}{"id": 1}}}
+	code, _ = postTestDelta(t, delta)
+	if code != 200 {
+		t.Fatal("Delta save handler HTTP code:", code)
+	}
+	if len(listDeltaKeys(deltaTestProject, Index2str(0), DefaultWorker)) != 2 {
+		t.Error("expected the save after the snapshot to be a delta")
+	}
+	// the delta revision before the snapshot is still loaded
+	sat, err = loadDeltaRevision(deltaTestProject, Index2str(0),
+		DefaultWorker, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	label = sat.Task.Items[0].Labels[3]
+	if len(label.Category) != 1 || label.Category[0] != 1 {
+		t.Error("wrong delta revision", sat.Task)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 // Poly2d datatype for 2d polygon
@@ -21,6 +23,8 @@ type ItemExport struct {
 	Timestamp  int64             `json:"timestamp" yaml:"timestamp"`
 	Index      int               `json:"index" yaml:"index"`
 	Labels     []LabelExport     `json:"labels" yaml:"labels"`
+	// gold-standard labels of an imported item, never exported
+	GroundTruth []LabelExport `json:"groundTruth,omitempty" yaml:"groundTruth,omitempty"`
 }
 
 // LabelExport datatype
@@ -32,6 +36,8 @@ type LabelExport struct {
 	Box2d       map[string]interface{} `json:"box2d" yaml:"box2d"`
 	Poly2d      []Poly2d               `json:"poly2d" yaml:"poly2d"`
 	Box3d       map[string]interface{} `json:"box3d" yaml:"box3d"`
+	// fraction of the workers who voted for a label merged by consensus
+	Confidence float64 `json:"confidence,omitempty" yaml:"confidence,omitempty"`
 }
 
 type ItemExportV2 struct {
@@ -53,6 +59,50 @@ type LabelExportV2 struct {
 	Box3d       interface{}            `json:"box3d" yaml:"box3d"`
 }
 
+// ToItemExport converts a v2 export item into the v1 export format
+func (itemV2 ItemExportV2) ToItemExport() ItemExport {
+	item := ItemExport{
+		Name:       itemV2.Name,
+		Url:        itemV2.Url,
+		VideoName:  itemV2.VideoName,
+		Attributes: itemV2.Attributes,
+		Timestamp:  itemV2.Timestamp,
+		Index:      itemV2.Index,
+	}
+	for _, labelV2 := range itemV2.Labels {
+		item.Labels = append(item.Labels, LabelExport{
+			Id:          labelV2.Id,
+			Category:    labelV2.Category,
+			Attributes:  labelV2.Attributes,
+			ManualShape: labelV2.ManualShape,
+			Box2d:       shapeToMap(labelV2.Box2d),
+			Poly2d:      labelV2.Poly2d,
+			Box3d:       shapeToMap(labelV2.Box3d),
+		})
+	}
+	return item
+}
+
+// converts an untyped shape into a map, nil shapes stay nil
+func shapeToMap(shape interface{}) map[string]interface{} {
+	if shape == nil {
+		return nil
+	}
+	if shapeMap, ok := shape.(map[string]interface{}); ok {
+		return shapeMap
+	}
+	shapeMap := map[string]interface{}{}
+	tmp, err := json.Marshal(shape)
+	if err != nil {
+		Error.Println(err)
+	}
+	err = json.Unmarshal(tmp, &shapeMap)
+	if err != nil {
+		Error.Println(err)
+	}
+	return shapeMap
+}
+
 // structs for saved data
 
 // VertexData for single vertex
@@ -202,10 +252,121 @@ func ParseBox3d(data map[string]interface{}) map[string]interface{} {
 	return box3d
 }
 
-//Parses SatLabel attributes for exportable format
-func parseSatLabelAttributes(map[string][]int) map[string]interface{} {
+// PathPointData for a single vertex of a v2 polygon or polyline
+type PathPointData struct {
+	X    float64 `json:"x" yaml:"x"`
+	Y    float64 `json:"y" yaml:"y"`
+	Type string  `json:"type" yaml:"type"`
+}
+
+// Vector3dData for a 3d vector of a v2 shape
+type Vector3dData struct {
+	X float64 `json:"x" yaml:"x"`
+	Y float64 `json:"y" yaml:"y"`
+	Z float64 `json:"z" yaml:"z"`
+}
+
+// CubeData for a v2 box3d
+type CubeData struct {
+	Center      Vector3dData `json:"center" yaml:"center"`
+	Size        Vector3dData `json:"size" yaml:"size"`
+	Orientation Vector3dData `json:"orientation" yaml:"orientation"`
+}
+
+// ParseCube parses a v2 cube into the v1 box3d export format
+func ParseCube(shape interface{}) map[string]interface{} {
+	cube := CubeData{}
+	MapToStruct(shapeToMap(shape), &cube)
+
+	box3d := map[string]interface{}{}
+	box3d["location"] = []float64{cube.Center.X, cube.Center.Y, cube.Center.Z}
+	box3d["orientation"] = []float64{cube.Orientation.X, cube.Orientation.Y,
+		cube.Orientation.Z}
+	box3d["dimension"] = []float64{cube.Size.X, cube.Size.Y, cube.Size.Z}
+	return box3d
+}
+
+// ParsePathPoints parses the v2 path points of a polygon or polyline
+func ParsePathPoints(shapes []interface{}, closed bool) []Poly2d {
+	poly := Poly2d{Closed: closed}
+	types := []byte{}
+	for _, shape := range shapes {
+		point := PathPointData{}
+		MapToStruct(shapeToMap(shape), &point)
+		poly.Vertices = append(poly.Vertices, []float64{point.X, point.Y})
+		// the frontend spells the bezier control points as "beizer"
+		if point.Type == "beizer" || point.Type == "bezier" {
+			types = append(types, 'C')
+		} else {
+			types = append(types, 'L')
+		}
+	}
+	poly.Types = string(types)
+	return []Poly2d{poly}
+}
+
+//Parses SatLabel attributes for exportable format. The attributes of a
+//label map the index of a config attribute to the indices of its selected
+//values. Switches are exported as booleans and lists as [index, value]
+//like in v1.
+func parseSatLabelAttributes(labelAttributes map[string][]int,
+	attributes []Attribute) map[string]interface{} {
+	exportAttributes := map[string]interface{}{}
+	for key, values := range labelAttributes {
+		attributeIndex, err := strconv.Atoi(key)
+		if err != nil || attributeIndex < 0 ||
+			attributeIndex >= len(attributes) {
+			Warning.Printf("Skipping unknown attribute %s\n", key)
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+		attribute := attributes[attributeIndex]
+		switch attribute.ToolType {
+		case "switch":
+			exportAttributes[attribute.Name] = values[0] > 0
+		case "list":
+			if values[0] < 0 || values[0] >= len(attribute.Values) {
+				Warning.Printf("Skipping value %d of attribute %s\n",
+					values[0], attribute.Name)
+				continue
+			}
+			exportAttributes[attribute.Name] = []interface{}{values[0],
+				attribute.Values[values[0]]}
+		}
+	}
+	return exportAttributes
+}
+
+// Converts the attributes of a v2 tag into the attributes of an exported
+// item, which are the names of the selected values
+func parseSatItemAttributes(labelAttributes map[string][]int,
+	attributes []Attribute) map[string]string {
+	itemAttributes := map[string]string{}
+	for name, value := range parseSatLabelAttributes(labelAttributes,
+		attributes) {
+		switch value := value.(type) {
+		case bool:
+			itemAttributes[name] = strconv.FormatBool(value)
+		case []interface{}:
+			itemAttributes[name] = value[1].(string)
+		}
+	}
+	return itemAttributes
+}
 
-	return map[string]interface{}{}
+// Joins the categories of a label like a v1 category path
+func parseSatLabelCategory(category []int, categories []string) string {
+	names := []string{}
+	for _, categoryIndex := range category {
+		if categoryIndex < 0 || categoryIndex >= len(categories) {
+			Warning.Printf("Skipping unknown category %d\n", categoryIndex)
+			continue
+		}
+		names = append(names, categories[categoryIndex])
+	}
+	return strings.Join(names, ",")
 }
 
 // helper function for v2 exporting, converts ItemData to ItemExportV2
@@ -217,41 +378,62 @@ func exportItemData(
 	projectName string) ItemExportV2 {
 	item := ItemExportV2{}
 	item.Index = itemToLoad.Index
-	if itemType == "video" {
+	if itemType == "video" || itemType == "pointcloudtracking" {
 		item.VideoName = projectName + "_" + Index2str(taskIndex)
 	}
 
-	item.Timestamp = satConfig.SubmitTime
 	item.Name = itemToLoad.Url
 	item.Url = itemToLoad.Url
-	// TODO: add attributes when implemented
-	// item.Attributes = parseAttributes(itemToLoad.attributes)
-
-	// map every label to its SatShape and create correct ordering
-	labelMap := make(map[int]int)
-	labelMapKeys := make([]int, 0)
-	for _, shape := range itemToLoad.Shapes {
-		for _, labelId := range shape.Label {
-			labelMap[labelId] = shape.Id
-			labelMapKeys = append(labelMapKeys, labelId)
-		}
-	}
+	item.Attributes = map[string]string{}
 
-	sort.Ints(labelMapKeys)
+	labelIds := make([]int, 0)
+	for labelId := range itemToLoad.Labels {
+		labelIds = append(labelIds, labelId)
+	}
+	sort.Ints(labelIds)
 	item.Labels = []LabelExportV2{}
-	itemLabel := LabelExportV2{}
 
 	// Iterate over labels and convert them to an exportable format
-	for _, labelId := range labelMapKeys {
-		shapeId := labelMap[labelId]
+	for _, labelId := range labelIds {
 		labelToLoad := itemToLoad.Labels[labelId]
+		shapes := []interface{}{}
+		for _, shapeId := range labelToLoad.Shapes {
+			if shape, ok := itemToLoad.Shapes[shapeId]; ok {
+				shapes = append(shapes, shape.Shape)
+			}
+		}
+		// the attributes of tags are the attributes of the item
+		if labelToLoad.Type == "tag" {
+			for name, value := range parseSatItemAttributes(
+				labelToLoad.Attributes, satConfig.Attributes) {
+				item.Attributes[name] = value
+			}
+		}
+		itemLabel := LabelExportV2{}
 		itemLabel.Id = labelId
-		itemLabel.Attributes = parseSatLabelAttributes(labelToLoad.Attributes)
-		// TODO: Handle multiple categories
-		itemLabel.Category = satConfig.Categories[labelToLoad.Category[0]]
-		if labelToLoad.Type == "box2d" {
-			itemLabel.ManualShape = false
-			itemLabel.Box2d = itemToLoad.Shapes[shapeId].Shape
+		itemLabel.Attributes = parseSatLabelAttributes(labelToLoad.Attributes,
+			satConfig.Attributes)
+		itemLabel.Category = parseSatLabelCategory(labelToLoad.Category,
+			satConfig.Categories)
+		itemLabel.ManualShape = labelToLoad.Manual
+		// labels of tracks are identified by their track
+		if (itemType == "video" || itemType == "pointcloudtracking") &&
+			labelToLoad.Track >= 0 {
+			itemLabel.Id = labelToLoad.Track
+		}
+		// labels without shapes, such as tags, keep only their category and
+		// attributes
+		if len(shapes) > 0 {
+			switch labelToLoad.Type {
+			case "box2d":
+				itemLabel.Box2d = shapes[0]
+			case "polygon2d":
+				itemLabel.Poly2d = ParsePathPoints(shapes, true)
+			case "polyline2d":
+				itemLabel.Poly2d = ParsePathPoints(shapes, false)
+			case "box3d":
+				itemLabel.Box3d = ParseCube(shapes[0])
+			}
 		}
 		item.Labels = append(item.Labels, itemLabel)
 	}
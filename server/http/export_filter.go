@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ExportFilter selects the tasks and labels of an export
+type ExportFilter struct {
+	// first and last exported task indices, TaskEnd is -1 for no last task
+	TaskStart int
+	TaskEnd   int
+	// only export tasks submitted by the worker
+	SubmittedOnly bool
+	// only export submissions accepted by a reviewer
+	AcceptedOnly bool
+	// worker whose labels are exported, empty for the worker who saved the
+	// latest submission of each task
+	Worker string
+	// exported category names, empty for all the categories
+	Categories []string
+	// export the items of tasks without a submission
+	IncludeUnlabeled bool
+	// merge the submissions of all the workers instead of exporting the
+	// submission of one worker
+	Consensus bool
+	// votes needed to keep a merged label
+	MinVotes int
+}
+
+// Parses the filter fields of an export request, formValue gets the value
+// of a field. Without any fields every task is exported as before.
+func parseExportFilter(formValue func(key string) string) (ExportFilter, error) {
+	filter := ExportFilter{
+		TaskStart:        0,
+		TaskEnd:          -1,
+		Categories:       []string{},
+		IncludeUnlabeled: true,
+		MinVotes:         defaultMinVotes,
+	}
+	var err error
+	if value := formValue("task_start"); value != "" {
+		filter.TaskStart, err = strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid task_start %s", value)
+		}
+	}
+	if value := formValue("task_end"); value != "" {
+		filter.TaskEnd, err = strconv.Atoi(value)
+		if err != nil || filter.TaskEnd < filter.TaskStart {
+			return filter, fmt.Errorf("Invalid task_end %s", value)
+		}
+	}
+	filter.SubmittedOnly = formValue("submitted_only") == "true"
+	filter.AcceptedOnly = formValue("accepted_only") == "true"
+	filter.Worker = formValue("worker")
+	for _, category := range strings.Split(formValue("categories"), ",") {
+		category = strings.TrimSpace(category)
+		if category != "" {
+			filter.Categories = append(filter.Categories, category)
+		}
+	}
+	filter.IncludeUnlabeled = formValue("include_unlabeled") != "false"
+	filter.Consensus = formValue("consensus") == "true"
+	if value := formValue("min_votes"); value != "" {
+		filter.MinVotes, err = strconv.Atoi(value)
+		if err != nil || filter.MinVotes < 1 {
+			return filter, fmt.Errorf("Invalid min_votes %s", value)
+		}
+	}
+	return filter, nil
+}
+
+// Parses the filter of an export request. Writes an error to the client
+// if the filter is invalid.
+func getRequestExportFilter(w http.ResponseWriter,
+	r *http.Request) (ExportFilter, bool) {
+	filter, err := parseExportFilter(r.FormValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return filter, false
+	}
+	return filter, true
+}
+
+// Checks if the index of a task is in the exported range
+func (filter ExportFilter) hasTask(task Task) bool {
+	return task.Index >= filter.TaskStart &&
+		(filter.TaskEnd < 0 || task.Index <= filter.TaskEnd)
+}
+
+// Selects the tasks in the exported range
+func (filter ExportFilter) filterTasks(tasks []Task) []Task {
+	filteredTasks := []Task{}
+	for _, task := range tasks {
+		if filter.hasTask(task) {
+			filteredTasks = append(filteredTasks, task)
+		}
+	}
+	return filteredTasks
+}
+
+// Checks if a category path is exported. A category is exported if any
+// category of its path is, so that a parent category selects its children.
+func (filter ExportFilter) hasCategory(categoryPath string) bool {
+	if len(filter.Categories) == 0 {
+		return true
+	}
+	for _, name := range strings.Split(categoryPath, ",") {
+		for _, category := range filter.Categories {
+			if name == category {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Removes the labels of the categories which are not exported
+func (filter ExportFilter) filterLabels(items []ItemExport) []ItemExport {
+	if len(filter.Categories) == 0 {
+		return items
+	}
+	for i, item := range items {
+		labels := []LabelExport{}
+		for _, label := range item.Labels {
+			if filter.hasCategory(label.Category) {
+				labels = append(labels, label)
+			}
+		}
+		items[i].Labels = labels
+	}
+	return items
+}
+
+// Gets the worker whose labels of a task are exported
+func (filter ExportFilter) taskWorker(projectName string,
+	taskIndex string) string {
+	if filter.Worker != "" {
+		return filter.Worker
+	}
+	return getLatestTaskWorker(projectName, taskIndex)
+}
+
+// Checks if the worker saved any submission of a task
+func hasSubmission(projectName string, taskIndex string,
+	workerId string) bool {
+	return len(listSubmissionKeys(projectName, taskIndex, workerId)) > 0
+}
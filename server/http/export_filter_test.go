@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+)
+
+const exportFilterTestProject = "scalabel_export_filter_test"
+
+func TestParseExportFilter(t *testing.T) {
+	filter, err := parseExportFilter(func(key string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.TaskEnd != -1 || filter.Worker != "" ||
+		!filter.IncludeUnlabeled || len(filter.Categories) != 0 {
+		t.Error("wrong default filter", filter)
+	}
+	values := map[string]string{
+		"task_start":        "1",
+		"task_end":          "2",
+		"submitted_only":    "true",
+		"worker":            "alice",
+		"categories":        "car, person",
+		"include_unlabeled": "false",
+	}
+	filter, err = parseExportFilter(func(key string) string {
+		return values[key]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.TaskStart != 1 || filter.TaskEnd != 2 || !filter.SubmittedOnly ||
+		filter.Worker != "alice" || len(filter.Categories) != 2 ||
+		filter.Categories[1] != "person" || filter.IncludeUnlabeled {
+		t.Error("wrong filter", filter)
+	}
+	tasks := filter.filterTasks([]Task{{Index: 0}, {Index: 1}, {Index: 2},
+		{Index: 3}})
+	if len(tasks) != 2 || tasks[0].Index != 1 {
+		t.Error("wrong tasks", tasks)
+	}
+	values["task_end"] = "0"
+	_, err = parseExportFilter(func(key string) string {
+		return values[key]
+	})
+	if err == nil {
+		t.Error("task_end before task_start should be invalid")
+	}
+}
+
+func TestExportFilterLabels(t *testing.T) {
+	filter := ExportFilter{Categories: []string{"vehicle", "person"}}
+	items := filter.filterLabels([]ItemExport{{Labels: []LabelExport{
+		{Id: 0, Category: "vehicle,car"},
+		{Id: 1, Category: "rider"},
+		{Id: 2, Category: "person"},
+	}}})
+	labels := items[0].Labels
+	if len(labels) != 2 || labels[0].Id != 0 || labels[1].Id != 2 {
+		t.Error("wrong labels", labels)
+	}
+}
+
+// Saves a submission of the first of two tasks
+func saveExportFilterTestProject(t *testing.T, submitted bool) Project {
+	project, _ := saveTestProject(t, exportFilterTestProject, [][]Item{
+		{{Url: "a.jpg", Index: 0}}, {{Url: "b.jpg", Index: 1}},
+	}, []testSubmission{{workerId: DefaultWorker, submitTime: 1,
+		labels: []Label{
+			{Id: 0, CategoryPath: "car"},
+			{Id: 1, CategoryPath: "person"},
+		},
+		submitted: submitted}})
+	return project
+}
+
+func exportFilterTestItems(t *testing.T, project Project,
+	filter ExportFilter) []ItemExport {
+	tasks, err := GetTasksInProject(exportFilterTestProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := collectItems(exportTaskStream(project, tasks, filter,
+		exportTaskItems))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestExportFilterSubmissions(t *testing.T) {
+	project := saveExportFilterTestProject(t, false)
+	defer deleteTestProject(t, exportFilterTestProject)
+	filter := ExportFilter{TaskEnd: -1, Worker: DefaultWorker,
+		IncludeUnlabeled: true}
+	items := exportFilterTestItems(t, project, filter)
+	if len(items) != 2 || len(items[0].Labels) != 2 {
+		t.Fatal("expected every item, got", items)
+	}
+	filter.IncludeUnlabeled = false
+	filter.Categories = []string{"person"}
+	items = exportFilterTestItems(t, project, filter)
+	if len(items) != 1 || len(items[0].Labels) != 1 ||
+		items[0].Labels[0].Category != "person" {
+		t.Error("expected the person of the labeled item, got", items)
+	}
+	// the only submission is not submitted
+	filter.SubmittedOnly = true
+	items = exportFilterTestItems(t, project, filter)
+	if len(items) != 0 {
+		t.Error("expected no submitted items, got", items)
+	}
+	filter.SubmittedOnly = false
+	filter.Worker = "nobody"
+	items = exportFilterTestItems(t, project, filter)
+	if len(items) != 0 {
+		t.Error("expected no items of another worker, got", items)
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// States of an export job
+const (
+	ExportJobQueued  = "queued"
+	ExportJobRunning = "running"
+	ExportJobDone    = "done"
+	ExportJobFailed  = "failed"
+)
+
+// number of jobs that can wait for a worker
+const exportJobQueueSize = 1024
+
+// size of the artifact chunks, small enough for every storage backend
+const exportChunkSize = 256 * 1024
+
+// default time in seconds for which a finished job is kept
+const defaultExportJobTtl = 7 * 24 * 3600
+
+// time in seconds between the deletions of the expired jobs
+const exportJobExpiryInterval = 3600
+
+//implements Serializable
+type ExportJob struct {
+	Id          string `json:"id" yaml:"id"`
+	ProjectName string `json:"projectName" yaml:"projectName"`
+	// export parameters, the same as the fields of the export form
+	Params     map[string]string `json:"params" yaml:"params"`
+	Status     string            `json:"status" yaml:"status"`
+	TasksDone  int               `json:"tasksDone" yaml:"tasksDone"`
+	TasksTotal int               `json:"tasksTotal" yaml:"tasksTotal"`
+	Error      string            `json:"error" yaml:"error"`
+	FileName   string            `json:"fileName" yaml:"fileName"`
+	NumChunks  int               `json:"numChunks" yaml:"numChunks"`
+	CreateTime int64             `json:"createTime" yaml:"createTime"`
+	FinishTime int64             `json:"finishTime" yaml:"finishTime"`
+}
+
+func (job *ExportJob) GetKey() string {
+	return path.Join(job.ProjectName, "exportJobs", job.Id)
+}
+
+func (job *ExportJob) GetFields() map[string]interface{} {
+	return map[string]interface{}{
+		"Id":          job.Id,
+		"ProjectName": job.ProjectName,
+		"Params":      job.Params,
+		"Status":      job.Status,
+		"TasksDone":   job.TasksDone,
+		"TasksTotal":  job.TasksTotal,
+		"Error":       job.Error,
+		"FileName":    job.FileName,
+		"NumChunks":   job.NumChunks,
+		"CreateTime":  job.CreateTime,
+		"FinishTime":  job.FinishTime,
+	}
+}
+
+// Key of a chunk of the exported file of a job
+func (job *ExportJob) chunkKey(chunk int) string {
+	return path.Join(job.ProjectName, "exportArtifacts", job.Id,
+		Index2str(chunk))
+}
+
+// Deletes the chunks of the exported file of a job, including the chunks
+// left over by an earlier run
+func (job *ExportJob) deleteArtifacts() error {
+	artifactDir := path.Join(job.ProjectName, "exportArtifacts", job.Id)
+	keys := storage.ListKeys(artifactDir)
+	for chunk := 0; chunk < job.NumChunks; chunk++ {
+		keys = append(keys, job.chunkKey(chunk))
+	}
+	for _, key := range keys {
+		err := storage.Delete(listedKey(storage, key))
+		if err != nil {
+			return err
+		}
+	}
+	return storage.Delete(artifactDir)
+}
+
+// Time in seconds for which a finished job is kept
+func exportJobTtl() int64 {
+	if env.ExportJobTtl > 0 {
+		return int64(env.ExportJobTtl)
+	}
+	return defaultExportJobTtl
+}
+
+// Export job as reported to the client
+type exportJobStatus struct {
+	ExportJob
+	DownloadUrl string `json:"downloadUrl,omitempty"`
+}
+
+// Export jobs known to the server, every change is saved to the storage
+type exportJobQueue struct {
+	sync.Mutex
+	jobs  map[string]*ExportJob
+	queue chan string
+}
+
+var exportJobs = &exportJobQueue{
+	jobs:  map[string]*ExportJob{},
+	queue: make(chan string, exportJobQueueSize),
+}
+
+// Adds a new job and waits for a worker to run it
+func (q *exportJobQueue) add(job ExportJob) error {
+	q.Lock()
+	defer q.Unlock()
+	select {
+	case q.queue <- job.Id:
+	default:
+		return errors.New("Too many export jobs are waiting")
+	}
+	q.jobs[job.Id] = &job
+	return storage.Save(job.GetKey(), job.GetFields())
+}
+
+// Gets a copy of a job
+func (q *exportJobQueue) get(id string) (ExportJob, bool) {
+	q.Lock()
+	defer q.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return ExportJob{}, false
+	}
+	return *job, true
+}
+
+// Changes a job with fn and saves it
+func (q *exportJobQueue) update(id string, fn func(job *ExportJob)) {
+	q.Lock()
+	defer q.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return
+	}
+	fn(job)
+	err := storage.Save(job.GetKey(), job.GetFields())
+	if err != nil {
+		Error.Println(err)
+	}
+}
+
+// Loads the jobs saved in the storage. Jobs which did not finish before the
+// server stopped are queued again and restart from the first task.
+func (q *exportJobQueue) resume() {
+	for _, projectName := range GetExistingProjects() {
+		for _, key := range storage.ListKeys(
+			path.Join(projectName, "exportJobs")) {
+			fields, err := storage.Load(key)
+			if err != nil {
+				Error.Println(err)
+				continue
+			}
+			job := ExportJob{}
+			err = mapstructure.Decode(fields, &job)
+			if err != nil {
+				Error.Println(err)
+				continue
+			}
+			q.Lock()
+			// jobs created since the server started are already queued
+			_, known := q.jobs[job.Id]
+			if !known {
+				q.jobs[job.Id] = &job
+			}
+			q.Unlock()
+			if known {
+				continue
+			}
+			if job.Status == ExportJobQueued ||
+				job.Status == ExportJobRunning {
+				Info.Printf("Resuming export job %s of %s\n", job.Id,
+					job.ProjectName)
+				q.update(job.Id, func(job *ExportJob) {
+					job.Status = ExportJobQueued
+					job.TasksDone = 0
+				})
+				q.queue <- job.Id
+			}
+		}
+	}
+}
+
+// Deletes the finished jobs older than the ttl with their exported files.
+// Returns the number of deleted jobs.
+func (q *exportJobQueue) expire(ttl int64) int {
+	now := recordTimestamp()
+	expired := []ExportJob{}
+	q.Lock()
+	for id, job := range q.jobs {
+		if (job.Status == ExportJobDone || job.Status == ExportJobFailed) &&
+			job.FinishTime+ttl <= now {
+			expired = append(expired, *job)
+			delete(q.jobs, id)
+		}
+	}
+	q.Unlock()
+	for _, job := range expired {
+		err := job.deleteArtifacts()
+		if err == nil {
+			err = storage.Delete(job.GetKey())
+		}
+		if err != nil {
+			Error.Println(err)
+		}
+	}
+	return len(expired)
+}
+
+// Runs a job and saves the exported file in chunks
+func (q *exportJobQueue) run(id string) {
+	job, ok := q.get(id)
+	if !ok {
+		return
+	}
+	// the chunks of an earlier run are replaced
+	err := job.deleteArtifacts()
+	if err != nil {
+		Error.Println(err)
+	}
+	q.update(id, func(job *ExportJob) {
+		job.Status = ExportJobRunning
+		job.NumChunks = 0
+	})
+	artifact := &exportArtifactWriter{job: job}
+	fileName, err := runExportJob(job, artifact)
+	if err == nil {
+		err = artifact.Close()
+	}
+	q.update(id, func(job *ExportJob) {
+		job.FinishTime = recordTimestamp()
+		if err != nil {
+			Error.Println(err)
+			job.Status = ExportJobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = ExportJobDone
+		job.FileName = fileName
+		job.NumChunks = artifact.chunk
+	})
+}
+
+// Exports the project of a job to w and returns the name of the file
+func runExportJob(job ExportJob, w *exportArtifactWriter) (string, error) {
+	project, err := GetProject(job.ProjectName)
+	if err != nil {
+		return "", err
+	}
+	format := job.Params["format"]
+	if format == "" {
+		format = "scalabel"
+	}
+	exporter, err := GetExporter(format, project.Options.LabelType)
+	if err != nil {
+		return "", err
+	}
+	filter, err := parseExportFilter(func(key string) string {
+		return job.Params[key]
+	})
+	if err != nil {
+		return "", err
+	}
+	tasks, err := GetTasksInProject(job.ProjectName)
+	if err != nil {
+		return "", err
+	}
+	exportTask := projectExportTask(project)
+	exportJobs.update(job.Id, func(job *ExportJob) {
+		job.TasksTotal = len(filter.filterTasks(tasks))
+	})
+	stream := exportTaskStream(project, tasks, filter, exportTask)
+	// report the progress after each task
+	tasksDone := 0
+	progressStream := func(fn func(items []ItemExport) error) error {
+		return stream(func(items []ItemExport) error {
+			err := fn(items)
+			tasksDone++
+			exportJobs.update(job.Id, func(job *ExportJob) {
+				job.TasksDone = tasksDone
+			})
+			return err
+		})
+	}
+	compress := job.Params["gzip"] == "true"
+	err = writeExportFile(w, exporter, project, progressStream, compress)
+	return exportFileName(exporter, project, compress), err
+}
+
+// Saves the exported file of a job in chunks of base64 encoded data
+type exportArtifactWriter struct {
+	job   ExportJob
+	buf   []byte
+	chunk int
+}
+
+func (w *exportArtifactWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= exportChunkSize {
+		err := w.flush(w.buf[:exportChunkSize])
+		if err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[exportChunkSize:]
+	}
+	return len(p), nil
+}
+
+// Close saves the last chunk
+func (w *exportArtifactWriter) Close() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.flush(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *exportArtifactWriter) flush(data []byte) error {
+	err := storage.Save(w.job.chunkKey(w.chunk), map[string]interface{}{
+		"data": base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return err
+	}
+	w.chunk++
+	return nil
+}
+
+// StartExportWorkers starts the goroutines running the export jobs and
+// queues the jobs left over by the last run of the server
+func StartExportWorkers(numWorkers int) {
+	if numWorkers <= 0 {
+		numWorkers = 2
+	}
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			for id := range exportJobs.queue {
+				exportJobs.run(id)
+			}
+		}()
+	}
+	go func() {
+		exportJobs.resume()
+		for {
+			deleted := exportJobs.expire(exportJobTtl())
+			if deleted > 0 {
+				Info.Printf("Deleted %d expired export jobs\n", deleted)
+			}
+			time.Sleep(exportJobExpiryInterval * time.Second)
+		}
+	}()
+}
+
+// Handles the creation of an export job. The form fields are the same as
+// the fields of the export endpoints.
+func postExportJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	projectName := r.FormValue("project_name")
+	project, err := GetProject(projectName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := getRequestExporter(w, r, project); !ok {
+		return
+	}
+	if _, ok := getRequestExportFilter(w, r); !ok {
+		return
+	}
+	params := map[string]string{}
+	for key, values := range r.Form {
+		if key != "project_name" && len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	job := ExportJob{
+		Id:          getUuidV4(),
+		ProjectName: projectName,
+		Params:      params,
+		Status:      ExportJobQueued,
+		CreateTime:  recordTimestamp(),
+	}
+	err = exportJobs.add(job)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeExportJobStatus(w, job)
+}
+
+// Handles the status and the download of an export job,
+// /exportJobs/{id} and /exportJobs/{id}/download
+func getExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.NotFound(w, r)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/exportJobs/")
+	download := strings.HasSuffix(id, "/download")
+	id = strings.TrimSuffix(id, "/download")
+	job, ok := exportJobs.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !download {
+		writeExportJobStatus(w, job)
+		return
+	}
+	if job.Status != ExportJobDone {
+		http.Error(w, fmt.Sprintf("Export job %s is %s", id, job.Status),
+			http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%s", job.FileName))
+	for chunk := 0; chunk < job.NumChunks; chunk++ {
+		fields, err := storage.Load(job.chunkKey(chunk))
+		if err != nil {
+			Error.Println(err)
+			return
+		}
+		encoded, _ := fields["data"].(string)
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			Error.Println(err)
+			return
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			Error.Println(err)
+			return
+		}
+	}
+}
+
+func writeExportJobStatus(w http.ResponseWriter, job ExportJob) {
+	status := exportJobStatus{ExportJob: job}
+	if job.Status == ExportJobDone {
+		status.DownloadUrl = fmt.Sprintf("/exportJobs/%s/download", job.Id)
+	}
+	statusJson, err := json.Marshal(status)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(statusJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const exportJobTestProject = "scalabel_export_job_test"
+
+// Saves a project with two tasks of one item each
+func saveExportJobTestProject(t *testing.T) {
+	saveTestProject(t, exportJobTestProject, [][]Item{
+		{{Url: "a.jpg", Index: 0}}, {{Url: "b.jpg", Index: 1}},
+	}, nil)
+}
+
+func getExportJobTest(t *testing.T, url string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	getExportJobHandler(rr, req)
+	return rr
+}
+
+func TestExportJob(t *testing.T) {
+	saveExportJobTestProject(t)
+	defer deleteTestProject(t, exportJobTestProject)
+	req, err := http.NewRequest("POST", "/exportJobs",
+		strings.NewReader("project_name="+exportJobTestProject+
+			"&format=ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	postExportJobsHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Export job creation HTTP code:", rr.Code, rr.Body.String())
+	}
+	status := exportJobStatus{}
+	err = json.Unmarshal(rr.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != ExportJobQueued || status.Params["format"] != "ndjson" {
+		t.Fatal("wrong job", status)
+	}
+	// run the job in place of a worker
+	id := <-exportJobs.queue
+	exportJobs.run(id)
+
+	// the stored state is the one reported to the client
+	stored := &ExportJob{Id: id, ProjectName: exportJobTestProject}
+	fields, err := storage.Load(stored.GetKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["Status"] != ExportJobDone {
+		t.Error("expected the stored job to be done, got", fields["Status"])
+	}
+	rr = getExportJobTest(t, "/exportJobs/"+id)
+	err = json.Unmarshal(rr.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != ExportJobDone || status.TasksDone != 2 ||
+		status.TasksTotal != 2 {
+		t.Fatal("wrong job status", status)
+	}
+	if status.FileName != exportJobTestProject+"_results.ndjson" {
+		t.Error("wrong file name", status.FileName)
+	}
+	rr = getExportJobTest(t, status.DownloadUrl)
+	if rr.Code != 200 {
+		t.Fatal("Export job download HTTP code:", rr.Code)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "b.jpg") {
+		t.Error("wrong export", rr.Body.String())
+	}
+	rr = getExportJobTest(t, "/exportJobs/unknown")
+	if rr.Code != 404 {
+		t.Error("expected 404 for an unknown job, got", rr.Code)
+	}
+
+	// jobs are kept until they expire, then deleted with their files
+	if deleted := exportJobs.expire(3600); deleted != 0 {
+		t.Error("expected no expired job, got", deleted)
+	}
+	if deleted := exportJobs.expire(-1); deleted != 1 {
+		t.Error("expected the job to expire, got", deleted)
+	}
+	if storage.HasKey(stored.GetKey()) || storage.HasKey(stored.chunkKey(0)) {
+		t.Error("expected the expired job and its file to be deleted")
+	}
+	rr = getExportJobTest(t, "/exportJobs/"+id)
+	if rr.Code != 404 {
+		t.Error("expected 404 for an expired job, got", rr.Code)
+	}
+}
+
+func TestExportArtifactChunks(t *testing.T) {
+	job := ExportJob{Id: "chunks", ProjectName: exportJobTestProject}
+	defer deleteTestProject(t, exportJobTestProject)
+	w := &exportArtifactWriter{job: job}
+	data := []byte(strings.Repeat("x", exportChunkSize*2+10))
+	_, err := w.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.chunk != 3 {
+		t.Error("expected 3 chunks, got", w.chunk)
+	}
+	if !storage.HasKey(job.chunkKey(2)) {
+		t.Error("missing last chunk")
+	}
+
+	// a shorter run replaces the chunks of the earlier run
+	err = job.deleteArtifacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for chunk := 0; chunk < 3; chunk++ {
+		if storage.HasKey(job.chunkKey(chunk)) {
+			t.Error("expected chunk", chunk, "to be deleted")
+		}
+	}
+}
@@ -559,3 +559,106 @@ func TestExportItemDataBox2dFull(t *testing.T) {
 	}
 
 }
+
+// Tests polygons, cubes, attributes, categories and tracks of v2 labels
+func TestExportItemDataShapes(t *testing.T) {
+	config := ConfigData{
+		Categories: []string{"car", "person"},
+		Attributes: importTestAttributes,
+	}
+	itemData := ItemData{
+		Labels: map[int]LabelData{
+			0: {Id: 0, Type: "polygon2d", Category: []int{1}, Shapes: []int{0, 1, 2},
+				Track: 5, Manual: true,
+				Attributes: map[string][]int{"0": {1}, "2": {2}}},
+			1: {Id: 1, Type: "box3d", Category: []int{0, 1}, Shapes: []int{3},
+				Track: -1},
+		},
+		Shapes: map[int]ShapeData{
+			0: {Id: 0, Shape: map[string]interface{}{"x": 1., "y": 2., "type": "line"}},
+			1: {Id: 1, Shape: map[string]interface{}{"x": 3., "y": 4., "type": "beizer"}},
+			2: {Id: 2, Shape: map[string]interface{}{"x": 5., "y": 6., "type": "line"}},
+			3: {Id: 3, Shape: map[string]interface{}{
+				"center":      map[string]interface{}{"x": 1., "y": 2., "z": 3.},
+				"size":        map[string]interface{}{"x": 4., "y": 5., "z": 6.},
+				"orientation": map[string]interface{}{"x": 0., "y": 0., "z": 1.},
+			}},
+		},
+	}
+	item := exportItemData(itemData, config, 0, "video", "test")
+	if len(item.Labels) != 2 {
+		t.Fatal("expected 2 labels, got", item.Labels)
+	}
+	polygon := item.Labels[0]
+	if polygon.Id != 5 || !polygon.ManualShape || polygon.Category != "person" {
+		t.Error("wrong polygon label", polygon)
+	}
+	if len(polygon.Poly2d) != 1 || polygon.Poly2d[0].Types != "LCL" ||
+		!polygon.Poly2d[0].Closed ||
+		!FloatArrayOfArrayEqual(polygon.Poly2d[0].Vertices,
+			[][]float64{{1, 2}, {3, 4}, {5, 6}}) {
+		t.Error("wrong polygon", polygon.Poly2d)
+	}
+	expectedAttributes := map[string]interface{}{
+		"Occluded":            true,
+		"Traffic Light Color": []interface{}{2, "Y"},
+	}
+	if !reflect.DeepEqual(polygon.Attributes, expectedAttributes) {
+		t.Error("wrong attributes", polygon.Attributes)
+	}
+	cube := item.Labels[1]
+	if cube.Id != 1 || cube.Category != "car,person" {
+		t.Error("wrong cube label", cube)
+	}
+	box3d := shapeToMap(cube.Box3d)
+	if !reflect.DeepEqual(box3d["location"], []float64{1, 2, 3}) ||
+		!reflect.DeepEqual(box3d["dimension"], []float64{4, 5, 6}) ||
+		!reflect.DeepEqual(box3d["orientation"], []float64{0, 0, 1}) {
+		t.Error("wrong box3d", box3d)
+	}
+}
+
+// Tests that tags are exported with their category and set the attributes
+// of the item
+func TestExportItemDataTag(t *testing.T) {
+	config := ConfigData{
+		Categories: []string{"car", "person"},
+		Attributes: importTestAttributes,
+	}
+	itemData := ItemData{
+		Labels: map[int]LabelData{
+			0: {Id: 0, Type: "tag", Category: []int{1}, Shapes: []int{},
+				Attributes: map[string][]int{"1": {0}, "2": {3}}},
+		},
+	}
+	item := exportItemData(itemData, config, 0, "image", "test")
+	if len(item.Labels) != 1 || item.Labels[0].Category != "person" {
+		t.Fatal("expected the tag label, got", item.Labels)
+	}
+	expectedAttributes := map[string]interface{}{
+		"Truncated":           false,
+		"Traffic Light Color": []interface{}{3, "R"},
+	}
+	if !reflect.DeepEqual(item.Labels[0].Attributes, expectedAttributes) {
+		t.Error("wrong label attributes", item.Labels[0].Attributes)
+	}
+	if item.Labels[0].Box2d != nil || item.Labels[0].Poly2d != nil {
+		t.Error("expected no shapes, got", item.Labels[0])
+	}
+	expectedItemAttributes := map[string]string{
+		"Truncated":           "false",
+		"Traffic Light Color": "R",
+	}
+	if !reflect.DeepEqual(item.Attributes, expectedItemAttributes) {
+		t.Error("wrong item attributes", item.Attributes)
+	}
+
+	// the timestamps of labeled items are the timestamps of the task items
+	sat := Sat{Task: TaskData{Config: config,
+		Items: []ItemData{{Index: 1}}}}
+	task := Task{Items: []Item{{Index: 1, Timestamp: 42}}}
+	items := satItemExports(Project{}, sat, task)
+	if len(items) != 1 || items[0].Timestamp != 42 {
+		t.Error("expected the timestamp of the task item, got", items)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// Exporter writes the exported items of a project in a file format
+type Exporter interface {
+	// FileName returns the name of the downloaded file
+	FileName(projectName string) string
+	// Export writes the items of the project to w
+	Export(w io.Writer, project Project, items []ItemExport) error
+}
+
+// ItemStream calls fn with the exported items of each task of a project in
+// order, so that a whole project never has to be held in memory
+type ItemStream func(fn func(items []ItemExport) error) error
+
+// StreamExporter is implemented by exporters which write the items of a
+// project task by task. Exporters which need every item at once, such as
+// formats with global ids, only implement Exporter.
+type StreamExporter interface {
+	Exporter
+	// ExportStream writes the items of the stream to w as they come
+	ExportStream(w io.Writer, project Project, stream ItemStream) error
+}
+
+// Converts a task into exported items
+type exportTaskFunc func(project Project, task Task,
+	filter ExportFilter) []ItemExport
+
+// Gets the function converting the tasks of a project, which are v1
+// assignments or v2 sats depending on the labeling interface of the project
+func projectExportTask(project Project) exportTaskFunc {
+	if isV2Project(project.Options) {
+		return exportTaskItemsV2AsV1
+	}
+	return exportTaskItems
+}
+
+// Creates a stream exporting the tasks selected by the filter one after the
+// other with exportTask
+func exportTaskStream(project Project, tasks []Task, filter ExportFilter,
+	exportTask exportTaskFunc) ItemStream {
+	filteredTasks := filter.filterTasks(tasks)
+	if filter.Consensus {
+		exportTask = consensusTaskItems(exportTask)
+	}
+	return func(fn func(items []ItemExport) error) error {
+		for i, task := range filteredTasks {
+			items := filter.filterLabels(exportTask(project, task, filter))
+			err := fn(items)
+			if err != nil {
+				return err
+			}
+			Info.Printf("Exported task %d of %d of %s\n", i+1,
+				len(filteredTasks), project.Options.Name)
+		}
+		return nil
+	}
+}
+
+// Collects all the items of a stream
+func collectItems(stream ItemStream) ([]ItemExport, error) {
+	items := []ItemExport{}
+	err := stream(func(taskItems []ItemExport) error {
+		items = append(items, taskItems...)
+		return nil
+	})
+	return items, err
+}
+
+// ExportFormat describes a registered export format
+type ExportFormat struct {
+	Name string `json:"name"`
+	// empty if the format supports every label type
+	LabelTypes []string `json:"labelTypes"`
+}
+
+// key of the exporter registry, an empty label type matches every label type
+type exporterKey struct {
+	format    string
+	labelType string
+}
+
+var exporters = map[exporterKey]Exporter{}
+
+// RegisterExporter makes an exporter available to the export endpoints under
+// the format name for the given label types, or for all label types if none
+// are given. Registering the same format and label type twice panics.
+func RegisterExporter(format string, exporter Exporter, labelTypes ...string) {
+	if len(labelTypes) == 0 {
+		labelTypes = []string{""}
+	}
+	for _, labelType := range labelTypes {
+		key := exporterKey{format, labelType}
+		if _, ok := exporters[key]; ok {
+			panic(fmt.Sprintf("exporter %s already registered for %q",
+				format, labelType))
+		}
+		exporters[key] = exporter
+	}
+}
+
+// GetExporter finds the exporter of a format for a label type
+func GetExporter(format string, labelType string) (Exporter, error) {
+	if exporter, ok := exporters[exporterKey{format, labelType}]; ok {
+		return exporter, nil
+	}
+	if exporter, ok := exporters[exporterKey{format, ""}]; ok {
+		return exporter, nil
+	}
+	return nil, fmt.Errorf("Export format %s is not available for %s",
+		format, labelType)
+}
+
+// ExportFormats lists the registered formats sorted by name
+func ExportFormats() []ExportFormat {
+	labelTypes := map[string][]string{}
+	for key := range exporters {
+		if _, ok := labelTypes[key.format]; !ok {
+			labelTypes[key.format] = []string{}
+		}
+		if key.labelType != "" {
+			labelTypes[key.format] = append(labelTypes[key.format],
+				key.labelType)
+		}
+	}
+	formats := []ExportFormat{}
+	for name, types := range labelTypes {
+		// a format registered for all label types supports every label type
+		if _, ok := exporters[exporterKey{name, ""}]; ok {
+			types = []string{}
+		}
+		sort.Strings(types)
+		formats = append(formats, ExportFormat{name, types})
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i].Name < formats[j].Name
+	})
+	return formats
+}
+
+// Scalabel json format, the same format is used to import items
+type scalabelExporter struct{}
+
+func (scalabelExporter) FileName(projectName string) string {
+	return fmt.Sprintf("%s_results.json", projectName)
+}
+
+func (e scalabelExporter) Export(w io.Writer, project Project,
+	items []ItemExport) error {
+	return e.ExportStream(w, project, func(fn func([]ItemExport) error) error {
+		return fn(items)
+	})
+}
+
+// Writes the same indented json array as json.MarshalIndent one item at a
+// time
+func (scalabelExporter) ExportStream(w io.Writer, project Project,
+	stream ItemStream) error {
+	separator := "[\n  "
+	err := stream(func(items []ItemExport) error {
+		for _, item := range items {
+			itemJson, err := json.MarshalIndent(item, "  ", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, separator)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(itemJson)
+			if err != nil {
+				return err
+			}
+			separator = ",\n  "
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if separator == "[\n  " {
+		_, err = io.WriteString(w, "[]")
+	} else {
+		_, err = io.WriteString(w, "\n]")
+	}
+	return err
+}
+
+// Newline delimited scalabel json, one item per line
+type ndjsonExporter struct{}
+
+func (ndjsonExporter) FileName(projectName string) string {
+	return fmt.Sprintf("%s_results.ndjson", projectName)
+}
+
+func (e ndjsonExporter) Export(w io.Writer, project Project,
+	items []ItemExport) error {
+	return e.ExportStream(w, project, func(fn func([]ItemExport) error) error {
+		return fn(items)
+	})
+}
+
+func (ndjsonExporter) ExportStream(w io.Writer, project Project,
+	stream ItemStream) error {
+	encoder := json.NewEncoder(w)
+	return stream(func(items []ItemExport) error {
+		for _, item := range items {
+			err := encoder.Encode(item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func init() {
+	RegisterExporter("scalabel", scalabelExporter{})
+	RegisterExporter("ndjson", ndjsonExporter{})
+	RegisterExporter("coco", cocoExporter{},
+		"box2d", "box2dv2", "segmentation", "lane")
+	RegisterExporter("kitti", kittiExporter{}, "box3d", "box3dv2")
+}
+
+// Finds the exporter requested by the format form field, which defaults
+// to the scalabel format. Writes an error to the client if there is none.
+func getRequestExporter(w http.ResponseWriter, r *http.Request,
+	project Project) (Exporter, bool) {
+	format := r.FormValue("format")
+	if format == "" {
+		format = "scalabel"
+	}
+	exporter, err := GetExporter(format, project.Options.LabelType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return exporter, true
+}
+
+// Writes the exported items to the response as an attachment. The export
+// is gzip compressed if the gzip form field is true.
+func writeExport(w http.ResponseWriter, r *http.Request, exporter Exporter,
+	project Project, stream ItemStream) {
+	compress := r.FormValue("gzip") == "true"
+	if compress {
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+	//set relevant header.
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%s",
+			exportFileName(exporter, project, compress)))
+	err := writeExportFile(w, exporter, project, stream, compress)
+	// the response has already started, so the error can only be logged
+	if err != nil {
+		Error.Println(err)
+	}
+}
+
+// Name of the exported file of a project
+func exportFileName(exporter Exporter, project Project, compress bool) string {
+	fileName := exporter.FileName(project.Options.Name)
+	if compress {
+		fileName += ".gz"
+	}
+	return fileName
+}
+
+// Writes the exported items to w. Streaming exporters write every task as
+// soon as it is exported.
+func writeExportFile(w io.Writer, exporter Exporter, project Project,
+	stream ItemStream, compress bool) error {
+	if compress {
+		gzipWriter := gzip.NewWriter(w)
+		err := writeExportFile(gzipWriter, exporter, project, stream, false)
+		if err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	}
+	if streamExporter, ok := exporter.(StreamExporter); ok {
+		return streamExporter.ExportStream(w, project, stream)
+	}
+	items, err := collectItems(stream)
+	if err != nil {
+		return err
+	}
+	return exporter.Export(w, project, items)
+}
+
+// Handles the listing of the available export formats
+func getExportFormatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.NotFound(w, r)
+		return
+	}
+	formats := ExportFormats()
+	labelType := r.FormValue("label_type")
+	if labelType != "" {
+		available := []ExportFormat{}
+		for _, format := range formats {
+			if _, err := GetExporter(format.Name, labelType); err == nil {
+				available = append(available, format)
+			}
+		}
+		formats = available
+	}
+	formatsJson, err := json.Marshal(formats)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(formatsJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetExporter(t *testing.T) {
+	exporter, err := GetExporter("coco", "box2d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := exporter.(cocoExporter); !ok {
+		t.Error("expected the coco exporter, got", exporter)
+	}
+	// formats registered without label types support all of them
+	_, err = GetExporter("scalabel", "box3d")
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = GetExporter("coco", "box3d")
+	if err == nil {
+		t.Error("coco should not be available for box3d")
+	}
+	_, err = GetExporter("unknown", "box2d")
+	if err == nil {
+		t.Error("unknown format should not be available")
+	}
+}
+
+func TestExportFormatsHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "exportFormats?label_type=box3d", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	getExportFormatsHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Export formats handler HTTP code:", rr.Code)
+	}
+	formats := []ExportFormat{}
+	err = json.Unmarshal(rr.Body.Bytes(), &formats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range formats {
+		if format.Name == "coco" {
+			t.Error("coco should not be listed for box3d")
+		}
+	}
+	if len(formats) == 0 || formats[len(formats)-1].Name != "scalabel" {
+		t.Error("scalabel should be listed for box3d, got", formats)
+	}
+}
+
+var streamTestTasks = []Task{{Index: 0}, {Index: 1}, {Index: 2}}
+
+var streamTestFilter = ExportFilter{TaskEnd: -1}
+
+// exports two items per task
+func streamTestTaskItems(project Project, task Task,
+	filter ExportFilter) []ItemExport {
+	return []ItemExport{
+		{Name: "a", Index: task.Index * 2,
+			Labels: []LabelExport{{Id: 1, Category: "car"}}},
+		{Name: "b", Index: task.Index*2 + 1},
+	}
+}
+
+func TestScalabelExportStream(t *testing.T) {
+	stream := exportTaskStream(Project{}, streamTestTasks, streamTestFilter,
+		streamTestTaskItems)
+	items, err := collectItems(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expectedItems := range [][]ItemExport{items, {}} {
+		expected, err := json.MarshalIndent(expectedItems, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		err = scalabelExporter{}.Export(buf, Project{}, expectedItems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != string(expected) {
+			t.Error("expected", string(expected), "got", buf.String())
+		}
+	}
+}
+
+func TestNdjsonExportStream(t *testing.T) {
+	stream := exportTaskStream(Project{}, streamTestTasks, streamTestFilter,
+		streamTestTaskItems)
+	buf := new(bytes.Buffer)
+	err := ndjsonExporter{}.ExportStream(buf, Project{}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatal("expected 6 lines, got", len(lines))
+	}
+	for i, line := range lines {
+		item := ItemExport{}
+		err = json.Unmarshal([]byte(line), &item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Index != i {
+			t.Error("expected index", i, "got", item.Index)
+		}
+	}
+}
+
+func TestWriteExportGzip(t *testing.T) {
+	req, err := http.NewRequest("POST", "postExport?gzip=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	project := Project{Options: ProjectOptions{Name: "streamed"}}
+	writeExport(rr, req, scalabelExporter{}, project,
+		exportTaskStream(project, streamTestTasks, streamTestFilter,
+			streamTestTaskItems))
+	disposition := rr.Header().Get("Content-Disposition")
+	if disposition != "attachment; filename=streamed_results.json.gz" {
+		t.Error("wrong content disposition", disposition)
+	}
+	reader, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []ItemExport{}
+	err = json.Unmarshal(contents, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 6 {
+		t.Error("expected 6 items, got", len(items))
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Score of a submission on the gold-standard items of a task
+type GoldScore struct {
+	TaskIndex    int   `json:"taskIndex" yaml:"taskIndex"`
+	SubmitTime   int64 `json:"submitTime" yaml:"submitTime"`
+	NumGoldItems int   `json:"numGoldItems" yaml:"numGoldItems"`
+	// mean IoU of the labels matching the ground truth, which is the
+	// accuracy of the submission
+	Labels float64 `json:"labels" yaml:"labels"`
+	// fraction of the attributes of the matched labels with the same value
+	// as the ground truth
+	Attributes float64 `json:"attributes" yaml:"attributes"`
+}
+
+//implements Serializable
+type WorkerScores struct {
+	ProjectName string      `json:"projectName" yaml:"projectName"`
+	WorkerId    string      `json:"workerId" yaml:"workerId"`
+	History     []GoldScore `json:"history" yaml:"history"`
+	// mean accuracy of the latest score of each task, not saved
+	Accuracy float64 `json:"accuracy" yaml:"accuracy"`
+}
+
+func (scores *WorkerScores) GetKey() string {
+	return path.Join(scores.ProjectName, "scores", scores.WorkerId)
+}
+
+func (scores *WorkerScores) GetFields() map[string]interface{} {
+	return map[string]interface{}{
+		"ProjectName": scores.ProjectName,
+		"WorkerId":    scores.WorkerId,
+		"History":     scores.History,
+	}
+}
+
+// Computes the accuracy of a worker from the latest score of each task, so
+// that a resubmission replaces the earlier score of the task
+func (scores *WorkerScores) computeAccuracy() {
+	latest := map[int]GoldScore{}
+	for _, score := range scores.History {
+		if score.SubmitTime >= latest[score.TaskIndex].SubmitTime {
+			latest[score.TaskIndex] = score
+		}
+	}
+	scores.Accuracy = 0
+	for _, score := range latest {
+		scores.Accuracy += score.Labels / float64(len(latest))
+	}
+}
+
+// score histories are read and written together
+var scoreLock sync.Mutex
+
+// Gets the score history of a worker in a project
+func GetWorkerScores(projectName string, workerId string) (WorkerScores,
+	error) {
+	scores := WorkerScores{ProjectName: projectName, WorkerId: workerId,
+		History: []GoldScore{}}
+	fields, err := storage.Load(scores.GetKey())
+	if err != nil {
+		if _, ok := err.(*NotExistError); ok {
+			return scores, nil
+		}
+		return scores, err
+	}
+	err = mapstructure.Decode(fields, &scores)
+	scores.computeAccuracy()
+	return scores, err
+}
+
+// Ground truth labels are saved with their exported shapes in their data
+func labelExportToGroundTruth(labelExport LabelExport) Label {
+	return Label{
+		Id:           labelExport.Id,
+		CategoryPath: labelExport.Category,
+		Attributes:   labelExport.Attributes,
+		Data: map[string]interface{}{
+			"box2d":  labelExport.Box2d,
+			"poly2d": labelExport.Poly2d,
+			"box3d":  labelExport.Box3d,
+		},
+	}
+}
+
+func groundTruthToLabelExport(label Label) LabelExport {
+	labelExport := LabelExport{}
+	MapToStruct(label.Data, &labelExport)
+	labelExport.Id = label.Id
+	labelExport.Category = label.CategoryPath
+	labelExport.Attributes = label.Attributes
+	return labelExport
+}
+
+// Scores the latest submission of a worker against the ground truth of the
+// items of a task, and adds the score to the history of the worker. Tasks
+// without ground truth are not scored.
+func ScoreGoldItems(project Project, taskIndex int, workerId string,
+	submitTime int64, exportTask exportTaskFunc) (GoldScore, bool, error) {
+	score := GoldScore{TaskIndex: taskIndex, SubmitTime: submitTime}
+	task, err := GetTask(project.Options.Name, Index2str(taskIndex))
+	if err != nil {
+		return score, false, err
+	}
+	filter := ExportFilter{TaskEnd: -1, Worker: workerId,
+		IncludeUnlabeled: false}
+	items := exportTask(project, task, filter)
+	for _, taskItem := range task.Items {
+		if len(taskItem.GroundTruth) == 0 {
+			continue
+		}
+		goldItem := ItemExport{}
+		for _, label := range taskItem.GroundTruth {
+			goldItem.Labels = append(goldItem.Labels,
+				groundTruthToLabelExport(label))
+		}
+		workerItem := findExportItem(items, taskItem)
+		labels, attributes := compareItems(goldItem, workerItem,
+			categoryCounts{})
+		score.NumGoldItems++
+		score.Labels += labels
+		score.Attributes += attributes
+	}
+	if score.NumGoldItems == 0 {
+		return score, false, nil
+	}
+	score.Labels /= float64(score.NumGoldItems)
+	score.Attributes /= float64(score.NumGoldItems)
+
+	scoreLock.Lock()
+	defer scoreLock.Unlock()
+	scores, err := GetWorkerScores(project.Options.Name, workerId)
+	if err != nil {
+		return score, true, err
+	}
+	scores.History = append(scores.History, score)
+	return score, true, storage.Save(scores.GetKey(), scores.GetFields())
+}
+
+// Finds the exported item of a task item by its index, or by its url if no
+// exported item has its index. Returns an empty item if none matches.
+func findExportItem(items []ItemExport, taskItem Item) ItemExport {
+	for _, item := range items {
+		if item.Index == taskItem.Index {
+			return item
+		}
+	}
+	for _, item := range items {
+		if item.Url == taskItem.Url {
+			return item
+		}
+	}
+	return ItemExport{}
+}
+
+// Scores a submission, errors are only logged so that the submission
+// itself succeeds. The saves of the task are not locked, since the whole
+// task is exported.
+func scoreSubmission(projectName string, taskIndex string, workerId string,
+	submitTime int64, exportTask exportTaskFunc) {
+	project, err := GetProject(projectName)
+	if err != nil {
+		Error.Println(err)
+		return
+	}
+	index, err := strconv.Atoi(taskIndex)
+	if err != nil {
+		Error.Println(err)
+		return
+	}
+	score, ok, err := ScoreGoldItems(project, index, workerId, submitTime,
+		exportTask)
+	if err != nil {
+		Error.Println(err)
+	} else if ok {
+		Info.Printf("Gold score of %s on task %d of %s: %.3f\n", workerId,
+			index, projectName, score.Labels)
+	}
+}
+
+// Lists the score histories of the workers of a project, the least accurate
+// workers first
+func GetProjectWorkerScores(projectName string) ([]WorkerScores, error) {
+	workerScores := []WorkerScores{}
+	for _, key := range listChildKeys(path.Join(projectName, "scores")) {
+		scores, err := GetWorkerScores(projectName, path.Base(key))
+		if err != nil {
+			return workerScores, err
+		}
+		workerScores = append(workerScores, scores)
+	}
+	sort.SliceStable(workerScores, func(i, j int) bool {
+		return workerScores[i].Accuracy < workerScores[j].Accuracy
+	})
+	return workerScores, nil
+}
+
+// Handles the gold-standard scores of the workers of a project for admins
+func getWorkerScoresHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can see the scores of workers",
+			http.StatusForbidden)
+		return
+	}
+	workerScores, err := GetProjectWorkerScores(r.FormValue("project_name"))
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scoresJson, err := json.Marshal(workerScores)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(scoresJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const goldTestProject = "scalabel_gold_test"
+
+// Saves a project whose first item has a gold-standard car
+func saveGoldTestProject(t *testing.T) Task {
+	box := map[string]interface{}{"x1": 0, "y1": 0, "x2": 10, "y2": 10}
+	gold := labelExportToGroundTruth(LabelExport{Id: 0, Category: "car",
+		Box2d: box, Attributes: map[string]interface{}{"occluded": true}})
+	_, tasks := saveTestProject(t, goldTestProject, [][]Item{{
+		{Url: "a.jpg", Index: 0, GroundTruth: []Label{gold}},
+		{Url: "b.jpg", Index: 1},
+	}}, nil)
+	return tasks[0]
+}
+
+func TestGoldScore(t *testing.T) {
+	task := saveGoldTestProject(t)
+	defer deleteTestProject(t, goldTestProject)
+	assignment, err := CreateAssignment(goldTestProject, Index2str(0),
+		DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignment.Task.Items[0].GroundTruth) != 0 {
+		t.Error("expected the ground truth to be hidden from the worker")
+	}
+	assignment.Task.ProjectOptions.Submitted = true
+	assignment.Task.Items[0].LabelIds = []int{0}
+	assignment.Task.Items[1].LabelIds = []int{1}
+	assignment.Labels = []Label{
+		{Id: 0, CategoryPath: "car",
+			Data:       map[string]interface{}{"x": 0, "y": 0, "w": 10, "h": 8},
+			Attributes: map[string]interface{}{"occluded": false}},
+		{Id: 1, CategoryPath: "car",
+			Data: map[string]interface{}{"x": 0, "y": 0, "w": 10, "h": 10}},
+	}
+	assignmentJson, err := json.Marshal(assignment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "postSave",
+		bytes.NewReader(assignmentJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	postSaveHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Save handler HTTP code:", rr.Code)
+	}
+	scores, err := GetWorkerScores(goldTestProject, DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores.History) != 1 {
+		t.Fatal("expected a score of the submission, got", scores)
+	}
+	// only the first item is gold
+	score := scores.History[0]
+	if score.NumGoldItems != 1 || math.Abs(score.Labels-0.8) > 1e-9 ||
+		score.Attributes != 0 || math.Abs(scores.Accuracy-0.8) > 1e-9 {
+		t.Error("wrong score", score)
+	}
+
+	// a resubmission replaces the score of the task
+	_, _, err = ScoreGoldItems(Project{Options: task.ProjectOptions}, 0,
+		DefaultWorker, score.SubmitTime+1, func(Project, Task,
+			ExportFilter) []ItemExport {
+			return []ItemExport{}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workerScores, err := GetProjectWorkerScores(goldTestProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workerScores) != 1 || len(workerScores[0].History) != 2 ||
+		workerScores[0].Accuracy != 0 {
+		t.Error("wrong worker scores", workerScores)
+	}
+}
+
+func TestGoldScoreV2Submit(t *testing.T) {
+	saveGoldTestProject(t)
+	defer deleteTestProject(t, goldTestProject)
+	assignment, err := CreateAssignment(goldTestProject, Index2str(0),
+		DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sat := assignmentToSat(&assignment)
+	sat.Task.Config.Categories = []string{"car"}
+	sat.Task.Items[0].Labels[0] = LabelData{Id: 0, Type: "box2d",
+		Category: []int{0}, Shapes: []int{0}}
+	sat.Task.Items[0].Shapes[0] = ShapeData{Id: 0, Label: []int{0},
+		Type: "rect", Shape: map[string]interface{}{"x1": 0, "y1": 0,
+			"x2": 10, "y2": 10}}
+	for _, submit := range []bool{false, true} {
+		sat.Submit = submit
+		satJson, err := json.Marshal(sat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("POST", "postSaveV2",
+			bytes.NewReader(satJson))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		postSaveV2Handler(rr, req)
+		if rr.Code != 200 {
+			t.Fatal("Save handler HTTP code:", rr.Code)
+		}
+		scores, err := GetWorkerScores(goldTestProject, DefaultWorker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only the submission is scored
+		if !submit && len(scores.History) != 0 {
+			t.Error("expected the save not to be scored, got", scores)
+		}
+		if submit && (len(scores.History) != 1 || scores.Accuracy != 1) {
+			t.Error("expected a score of the submission, got", scores)
+		}
+	}
+}
+
+func TestGoldItemsMatchedByIndex(t *testing.T) {
+	task := saveGoldTestProject(t)
+	defer deleteTestProject(t, goldTestProject)
+	box := map[string]interface{}{"x1": 0.0, "y1": 0.0, "x2": 10.0,
+		"y2": 10.0}
+	score, ok, err := ScoreGoldItems(Project{Options: task.ProjectOptions},
+		0, DefaultWorker, 1, func(Project, Task, ExportFilter) []ItemExport {
+			// the items are not in the order of the task
+			return []ItemExport{
+				{Index: 1, Url: "b.jpg"},
+				{Index: 0, Url: "a.jpg", Labels: []LabelExport{
+					{Id: 0, Category: "car", Box2d: box}}},
+			}
+		})
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if score.Labels != 1 {
+		t.Error("expected the gold item to match its label, got", score)
+	}
+}
+
+func TestDashboardWithBrokenScores(t *testing.T) {
+	saveGoldTestProject(t)
+	defer deleteTestProject(t, goldTestProject)
+	scores := WorkerScores{ProjectName: goldTestProject, WorkerId: "alice"}
+	saveTestKey(t, scores.GetKey(), map[string]interface{}{
+		"History": "not a history"})
+	// the scores are optional, the dashboard is shown without them
+	contents, err := GetDashboardContents(goldTestProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents.TaskMetaDatas) != 1 || contents.WorkerScores != nil {
+		t.Error("wrong dashboard contents", contents)
+	}
+}
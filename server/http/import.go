@@ -0,0 +1,404 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportReport collects the entries of an import file that could not be
+// mapped onto the categories and attributes of the project
+type ImportReport struct {
+	counts map[string]int
+}
+
+// Add records an entry that could not be mapped
+func (report *ImportReport) Add(format string, a ...interface{}) {
+	if report.counts == nil {
+		report.counts = map[string]int{}
+	}
+	report.counts[fmt.Sprintf(format, a...)]++
+}
+
+// Empty checks whether every entry was mapped
+func (report *ImportReport) Empty() bool {
+	return len(report.counts) == 0
+}
+
+func (report *ImportReport) String() string {
+	messages := []string{}
+	for message, count := range report.counts {
+		messages = append(messages, fmt.Sprintf("%s (%d times)", message, count))
+	}
+	sort.Strings(messages)
+	return "Some imported entries could not be mapped:\n" +
+		strings.Join(messages, "\n")
+}
+
+// VOC annotation of a single image
+type vocAnnotation struct {
+	Folder   string      `xml:"folder"`
+	Filename string      `xml:"filename"`
+	Path     string      `xml:"path"`
+	Objects  []vocObject `xml:"object"`
+}
+
+// VOC annotation of a single object
+type vocObject struct {
+	Name      string `xml:"name"`
+	Pose      string `xml:"pose"`
+	Truncated string `xml:"truncated"`
+	Difficult string `xml:"difficult"`
+	Occluded  string `xml:"occluded"`
+	Bndbox    struct {
+		Xmin float64 `xml:"xmin"`
+		Ymin float64 `xml:"ymin"`
+		Xmax float64 `xml:"xmax"`
+		Ymax float64 `xml:"ymax"`
+	} `xml:"bndbox"`
+}
+
+// Detects the format of an item file from its name and contents
+func detectImportFormat(fileName string, contents []byte) string {
+	extension := strings.ToLower(path.Ext(fileName))
+	if extension == ".xml" || extension == ".zip" {
+		return "voc"
+	}
+	if extension == ".json" &&
+		strings.HasPrefix(strings.TrimSpace(string(contents)), "{") {
+		return "coco"
+	}
+	return "scalabel"
+}
+
+// Maps category names and paths onto the comma separated category path
+// used by the labels, resolving leaves by their name too
+func getCategoryPaths(categories []Category) map[string]string {
+	categoryPaths := map[string]string{}
+	var visit func(categories []Category, parents []string)
+	visit = func(categories []Category, parents []string) {
+		for _, category := range categories {
+			names := append(append([]string{}, parents...), category.Name)
+			if len(category.Subcategories) > 0 {
+				visit(category.Subcategories, names)
+				continue
+			}
+			categoryPath := strings.Join(names, ",")
+			categoryPaths[categoryPath] = categoryPath
+			if _, ok := categoryPaths[category.Name]; !ok {
+				categoryPaths[category.Name] = categoryPath
+			}
+		}
+	}
+	visit(categories, []string{})
+	return categoryPaths
+}
+
+// Resolves an imported category against the project categories. Without
+// project categories the imported name is kept as it is.
+func resolveImportCategory(name string, categoryPaths map[string]string,
+	report *ImportReport) (string, bool) {
+	if len(categoryPaths) == 0 {
+		return name, true
+	}
+	if categoryPath, ok := categoryPaths[name]; ok {
+		return categoryPath, true
+	}
+	if categoryPath, ok := categoryPaths[strings.ToLower(name)]; ok {
+		return categoryPath, true
+	}
+	report.Add("unknown category %q", name)
+	return "", false
+}
+
+// Parses a boolean like value of an imported switch attribute
+func parseImportSwitch(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case float64:
+		return v != 0, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	}
+	return false, false
+}
+
+// Converts imported label attributes into the format used by the labels:
+// booleans for switches and [index, value] pairs for lists
+func mapImportLabelAttributes(raw map[string]interface{},
+	attributes []Attribute, report *ImportReport) map[string]interface{} {
+	mapped := map[string]interface{}{}
+	for name, value := range raw {
+		var attribute *Attribute
+		for i := range attributes {
+			if strings.EqualFold(attributes[i].Name, name) {
+				attribute = &attributes[i]
+				break
+			}
+		}
+		if attribute == nil {
+			report.Add("unknown label attribute %q", name)
+			continue
+		}
+		switch attribute.ToolType {
+		case "switch":
+			b, ok := parseImportSwitch(value)
+			if !ok {
+				report.Add("invalid value %v of label attribute %q",
+					value, attribute.Name)
+				continue
+			}
+			mapped[attribute.Name] = b
+		case "list":
+			// exported list attributes are [index, value] pairs
+			if pair, ok := value.([]interface{}); ok && len(pair) == 2 {
+				value = pair[1]
+			}
+			valueString := fmt.Sprint(value)
+			found := false
+			for i, v := range attribute.Values {
+				if v == valueString {
+					mapped[attribute.Name] = []interface{}{i, v}
+					found = true
+					break
+				}
+			}
+			if !found {
+				report.Add("unknown value %q of label attribute %q",
+					valueString, attribute.Name)
+			}
+		default:
+			mapped[attribute.Name] = value
+		}
+	}
+	return mapped
+}
+
+// Converts a COCO polygon into a closed poly2d
+func cocoPolygonToPoly2d(polygon []float64) Poly2d {
+	poly := Poly2d{Closed: true}
+	for i := 0; i+1 < len(polygon); i += 2 {
+		poly.Vertices = append(poly.Vertices,
+			[]float64{polygon[i], polygon[i+1]})
+	}
+	poly.Types = strings.Repeat("L", len(poly.Vertices))
+	return poly
+}
+
+// Makes an item url out of an imported file name
+func importUrl(urlPrefix string, fileName string) string {
+	if urlPrefix == "" {
+		return fileName
+	}
+	return strings.TrimSuffix(urlPrefix, "/") + "/" +
+		strings.TrimPrefix(fileName, "/")
+}
+
+// Imports the images and annotations of a COCO json file
+func importCocoItems(contents []byte, urlPrefix string,
+	categories []Category, attributes []Attribute,
+	report *ImportReport) ([]ItemExport, error) {
+	// segmentation can also be run length encoded, so decode it lazily
+	var dataset struct {
+		Images      []CocoImage `json:"images"`
+		Annotations []struct {
+			CocoAnnotation
+			Segmentation json.RawMessage `json:"segmentation"`
+		} `json:"annotations"`
+		Categories []CocoCategory `json:"categories"`
+	}
+	err := json.Unmarshal(contents, &dataset)
+	if err != nil {
+		return nil, err
+	}
+	categoryPaths := getCategoryPaths(categories)
+	cocoCategoryNames := map[int]string{}
+	for _, category := range dataset.Categories {
+		cocoCategoryNames[category.Id] = category.Name
+	}
+	items := []ItemExport{}
+	imageIndices := map[int]int{}
+	for _, image := range dataset.Images {
+		url := image.CocoUrl
+		if url == "" {
+			url = importUrl(urlPrefix, image.FileName)
+		}
+		imageIndices[image.Id] = len(items)
+		items = append(items, ItemExport{
+			Name:       url,
+			Url:        url,
+			VideoName:  image.VideoName,
+			Attributes: image.Attributes,
+			Index:      image.Index,
+		})
+	}
+	for _, annotation := range dataset.Annotations {
+		itemIndex, ok := imageIndices[annotation.ImageId]
+		if !ok {
+			report.Add("annotation of unknown image %d", annotation.ImageId)
+			continue
+		}
+		categoryName, ok := cocoCategoryNames[annotation.CategoryId]
+		if !ok {
+			report.Add("unknown category id %d", annotation.CategoryId)
+			continue
+		}
+		categoryPath, ok := resolveImportCategory(categoryName,
+			categoryPaths, report)
+		if !ok {
+			continue
+		}
+		label := LabelExport{
+			Id:       annotation.Id,
+			Category: categoryPath,
+			Attributes: mapImportLabelAttributes(annotation.Attributes,
+				attributes, report),
+			ManualShape: true,
+		}
+		if len(annotation.Bbox) == 4 {
+			label.Box2d = map[string]interface{}{
+				"x1": annotation.Bbox[0],
+				"y1": annotation.Bbox[1],
+				"x2": annotation.Bbox[0] + annotation.Bbox[2],
+				"y2": annotation.Bbox[1] + annotation.Bbox[3],
+			}
+		}
+		if len(annotation.Segmentation) > 0 &&
+			annotation.Segmentation[0] == '[' {
+			var polygons [][]float64
+			err = json.Unmarshal(annotation.Segmentation, &polygons)
+			if err != nil {
+				return nil, err
+			}
+			for _, polygon := range polygons {
+				label.Poly2d = append(label.Poly2d, cocoPolygonToPoly2d(polygon))
+			}
+		} else if len(annotation.Segmentation) > 0 &&
+			string(annotation.Segmentation) != "null" {
+			report.Add("unsupported run length encoded segmentation")
+		}
+		if label.Box2d == nil && len(label.Poly2d) == 0 {
+			report.Add("annotation without bbox or polygon")
+			continue
+		}
+		items[itemIndex].Labels = append(items[itemIndex].Labels, label)
+	}
+	return items, nil
+}
+
+// Converts the flag of a VOC object into a label attribute if the project
+// has a matching attribute, reporting flags that are set but cannot be kept
+func addVocAttribute(raw map[string]interface{}, name string,
+	value string, attributes []Attribute, report *ImportReport) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" || strings.EqualFold(value, "unspecified") {
+		return
+	}
+	for _, attribute := range attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			raw[name] = value
+			return
+		}
+	}
+	report.Add("unknown label attribute %q", name)
+}
+
+// Converts a parsed VOC annotation into an item
+func vocAnnotationToItem(annotation vocAnnotation, urlPrefix string,
+	categoryPaths map[string]string, attributes []Attribute,
+	report *ImportReport) ItemExport {
+	fileName := annotation.Filename
+	if annotation.Folder != "" && urlPrefix != "" {
+		fileName = path.Join(annotation.Folder, fileName)
+	}
+	url := importUrl(urlPrefix, fileName)
+	if urlPrefix == "" && annotation.Path != "" {
+		url = annotation.Path
+	}
+	item := ItemExport{Name: url, Url: url}
+	for i, object := range annotation.Objects {
+		categoryPath, ok := resolveImportCategory(object.Name,
+			categoryPaths, report)
+		if !ok {
+			continue
+		}
+		raw := map[string]interface{}{}
+		addVocAttribute(raw, "truncated", object.Truncated, attributes, report)
+		addVocAttribute(raw, "occluded", object.Occluded, attributes, report)
+		addVocAttribute(raw, "difficult", object.Difficult, attributes, report)
+		addVocAttribute(raw, "pose", object.Pose, attributes, report)
+		item.Labels = append(item.Labels, LabelExport{
+			Id:          i,
+			Category:    categoryPath,
+			Attributes:  mapImportLabelAttributes(raw, attributes, report),
+			ManualShape: true,
+			Box2d: map[string]interface{}{
+				"x1": object.Bndbox.Xmin,
+				"y1": object.Bndbox.Ymin,
+				"x2": object.Bndbox.Xmax,
+				"y2": object.Bndbox.Ymax,
+			},
+		})
+	}
+	return item
+}
+
+// Imports Pascal VOC annotations, either a single xml file or a zip archive
+// of xml files
+func importVocItems(fileName string, contents []byte, urlPrefix string,
+	categories []Category, attributes []Attribute,
+	report *ImportReport) ([]ItemExport, error) {
+	files := map[string][]byte{}
+	if strings.ToLower(path.Ext(fileName)) == ".zip" {
+		archive, err := zip.NewReader(bytes.NewReader(contents),
+			int64(len(contents)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range archive.File {
+			if f.FileInfo().IsDir() ||
+				strings.ToLower(path.Ext(f.Name)) != ".xml" {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			files[f.Name], err = ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		files[fileName] = contents
+	}
+	// keep the order of the items stable
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	categoryPaths := getCategoryPaths(categories)
+	items := []ItemExport{}
+	for _, name := range names {
+		annotation := vocAnnotation{}
+		err := xml.Unmarshal(files[name], &annotation)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		items = append(items, vocAnnotationToItem(annotation, urlPrefix,
+			categoryPaths, attributes, report))
+	}
+	return items, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+var importTestAttributes = []Attribute{
+	{"Occluded", "switch", "o", "", nil, nil, nil},
+	{"Truncated", "switch", "t", "", nil, nil, nil},
+	{"Traffic Light Color", "list", "", "t",
+		[]string{"", "g", "y", "r"}, []string{"NA", "G", "Y", "R"},
+		[]string{"white", "green", "yellow", "red"},
+	},
+}
+
+const cocoImportJson = `{
+  "images": [
+    {"id": 7, "file_name": "a.jpg"},
+    {"id": 8, "file_name": "b.jpg", "coco_url": "http://host/b.jpg"}
+  ],
+  "categories": [
+    {"id": 1, "name": "rider"},
+    {"id": 2, "name": "spaceship"}
+  ],
+  "annotations": [
+    {"id": 1, "image_id": 7, "category_id": 1, "bbox": [1, 2, 3, 4],
+     "segmentation": [[0, 0, 10, 0, 10, 10]],
+     "attributes": {"Occluded": true, "Traffic Light Color": "G"}},
+    {"id": 2, "image_id": 8, "category_id": 2, "bbox": [1, 2, 3, 4]},
+    {"id": 3, "image_id": 8, "category_id": 1, "bbox": [1, 2, 3, 4],
+     "segmentation": {"counts": [1, 2], "size": [2, 2]}}
+  ]
+}`
+
+func TestImportCoco(t *testing.T) {
+	report := &ImportReport{}
+	items, err := importCocoItems([]byte(cocoImportJson), "http://prefix",
+		cocoTestCategories, importTestAttributes, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatal("expected 2 items, got", items)
+	}
+	if items[0].Url != "http://prefix/a.jpg" || items[1].Url != "http://host/b.jpg" {
+		t.Error("wrong urls", items[0].Url, items[1].Url)
+	}
+	if len(items[0].Labels) != 1 {
+		t.Fatal("expected 1 label, got", items[0].Labels)
+	}
+	label := items[0].Labels[0]
+	if label.Category != "human,rider" {
+		t.Error("expected category human,rider, got", label.Category)
+	}
+	if label.Box2d["x2"] != 4. || label.Box2d["y2"] != 6. {
+		t.Error("wrong box", label.Box2d)
+	}
+	if len(label.Poly2d) != 1 || label.Poly2d[0].Types != "LLL" {
+		t.Error("wrong polygon", label.Poly2d)
+	}
+	if label.Attributes["Occluded"] != true {
+		t.Error("wrong switch attribute", label.Attributes)
+	}
+	color, ok := label.Attributes["Traffic Light Color"].([]interface{})
+	if !ok || color[0] != 1 || color[1] != "G" {
+		t.Error("wrong list attribute", label.Attributes)
+	}
+	// the unknown category and the run length encoding are reported
+	if len(report.counts) != 2 {
+		t.Error("expected 2 reported entries, got", report.String())
+	}
+}
+
+const vocImportXml = `<annotation>
+  <folder>VOC2012</folder>
+  <filename>c.jpg</filename>
+  <object>
+    <name>car</name>
+    <pose>Left</pose>
+    <truncated>1</truncated>
+    <difficult>0</difficult>
+    <bndbox><xmin>10</xmin><ymin>20</ymin><xmax>30</xmax><ymax>40</ymax></bndbox>
+  </object>
+</annotation>`
+
+func TestImportVoc(t *testing.T) {
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+	f, err := archive.Create("Annotations/c.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte(vocImportXml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &ImportReport{}
+	items, err := importVocItems("voc.zip", buf.Bytes(), "",
+		cocoTestCategories, importTestAttributes, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || len(items[0].Labels) != 1 {
+		t.Fatal("expected 1 item with 1 label, got", items)
+	}
+	label := items[0].Labels[0]
+	if items[0].Url != "c.jpg" || label.Category != "car" {
+		t.Error("wrong item", items[0])
+	}
+	if label.Box2d["x1"] != 10. || label.Box2d["y2"] != 40. {
+		t.Error("wrong box", label.Box2d)
+	}
+	if label.Attributes["Truncated"] != true {
+		t.Error("wrong attributes", label.Attributes)
+	}
+	// the pose has no matching project attribute
+	if len(report.counts) != 1 {
+		t.Error("expected 1 reported entry, got", report.String())
+	}
+}
+
+func TestDetectImportFormat(t *testing.T) {
+	formats := map[string]string{
+		"coco":     detectImportFormat("a.json", []byte(cocoImportJson)),
+		"scalabel": detectImportFormat("a.json", []byte("[]")),
+		"voc":      detectImportFormat("a.zip", nil),
+	}
+	for expected, format := range formats {
+		if format != expected {
+			t.Error("expected", expected, "got", format)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// KITTI style box3d
+type kittiBox3d struct {
+	Type string
+	// height, width and length of the box
+	Dimensions [3]float64
+	Location   [3]float64
+	RotationY  float64
+}
+
+// Parses a 3d vector stored either as [x, y, z] or as {x, y, z}
+func parseVector3d(data interface{}) ([3]float64, bool) {
+	vector := [3]float64{}
+	switch v := data.(type) {
+	case []float64:
+		if len(v) != 3 {
+			return vector, false
+		}
+		copy(vector[:], v)
+		return vector, true
+	case []interface{}:
+		if len(v) != 3 {
+			return vector, false
+		}
+		for i, value := range v {
+			f, ok := value.(float64)
+			if !ok {
+				return vector, false
+			}
+			vector[i] = f
+		}
+		return vector, true
+	case map[string]interface{}:
+		for i, key := range []string{"x", "y", "z"} {
+			f, ok := v[key].(float64)
+			if !ok {
+				return vector, false
+			}
+			vector[i] = f
+		}
+		return vector, true
+	}
+	return vector, false
+}
+
+// Converts an exported box3d into KITTI conventions. The box stays in the
+// point cloud frame, whose vertical axis is z, so the yaw around z is used
+// as rotation_y.
+func labelToKittiBox3d(label LabelExport) (kittiBox3d, bool) {
+	box := kittiBox3d{}
+	if label.Box3d == nil {
+		return box, false
+	}
+	location, ok := parseVector3d(label.Box3d["location"])
+	if !ok {
+		return box, false
+	}
+	orientation, ok := parseVector3d(label.Box3d["orientation"])
+	if !ok {
+		return box, false
+	}
+	scale, ok := parseVector3d(label.Box3d["dimension"])
+	if !ok {
+		return box, false
+	}
+	categories := strings.Split(label.Category, ",")
+	box.Type = strings.Replace(categories[len(categories)-1], " ", "_", -1)
+	if box.Type == "" {
+		box.Type = "DontCare"
+	}
+	box.Dimensions = [3]float64{scale[2], scale[1], scale[0]}
+	box.Location = location
+	box.RotationY = orientation[2]
+	return box, true
+}
+
+// Formats a box as a KITTI label line without the image related fields,
+// which are set to their "unknown" values
+func (box kittiBox3d) String() string {
+	return fmt.Sprintf("%s 0 0 -10 -1 -1 -1 -1 %f %f %f %f %f %f %f",
+		box.Type, box.Dimensions[0], box.Dimensions[1], box.Dimensions[2],
+		box.Location[0], box.Location[1], box.Location[2], box.RotationY)
+}
+
+// KITTI label text files for 3d boxes, packaged as a zip archive. Point cloud
+// projects get one label file per frame. Tracking projects get one file per
+// sequence, with the frame index and the track id in front of every box as
+// in the KITTI tracking benchmark.
+type kittiExporter struct{}
+
+func (kittiExporter) FileName(projectName string) string {
+	return fmt.Sprintf("%s_kitti.zip", projectName)
+}
+
+func (kittiExporter) Export(w io.Writer, project Project,
+	items []ItemExport) error {
+	archive := zip.NewWriter(w)
+	var err error
+	if project.Options.ItemType == "pointcloudtracking" {
+		err = writeKittiTracking(archive, items)
+	} else {
+		err = writeKittiObjects(archive, items)
+	}
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// Writes one label file per frame
+func writeKittiObjects(archive *zip.Writer, items []ItemExport) error {
+	for i, item := range items {
+		f, err := archive.Create(fmt.Sprintf("label_2/%06d.txt", i))
+		if err != nil {
+			return err
+		}
+		for _, label := range item.Labels {
+			box, ok := labelToKittiBox3d(label)
+			if !ok {
+				continue
+			}
+			_, err = fmt.Fprintln(f, box)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return writeKittiFrameMap(archive, items)
+}
+
+// Writes one label file per sequence, items are grouped by video name
+func writeKittiTracking(archive *zip.Writer, items []ItemExport) error {
+	sequences := map[string][]ItemExport{}
+	sequenceNames := []string{}
+	for _, item := range items {
+		if _, ok := sequences[item.VideoName]; !ok {
+			sequenceNames = append(sequenceNames, item.VideoName)
+		}
+		sequences[item.VideoName] = append(sequences[item.VideoName], item)
+	}
+	for i, name := range sequenceNames {
+		f, err := archive.Create(fmt.Sprintf("label_02/%04d.txt", i))
+		if err != nil {
+			return err
+		}
+		sequence := sequences[name]
+		sort.SliceStable(sequence, func(i, j int) bool {
+			return sequence[i].Index < sequence[j].Index
+		})
+		for _, item := range sequence {
+			for _, label := range item.Labels {
+				box, ok := labelToKittiBox3d(label)
+				if !ok {
+					continue
+				}
+				_, err = fmt.Fprintf(f, "%d %d %s\n", item.Index, label.Id, box)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// entries of a zip archive are written one after the other, so the
+	// sequence map comes after the label files
+	sequenceMap, err := archive.Create("sequence_map.txt")
+	if err != nil {
+		return err
+	}
+	for i, name := range sequenceNames {
+		_, err = fmt.Fprintf(sequenceMap, "%04d %s\n", i, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the urls of the point clouds matching the label files
+func writeKittiFrameMap(archive *zip.Writer, items []ItemExport) error {
+	f, err := archive.Create("frame_map.txt")
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		_, err = fmt.Fprintf(f, "%06d %s\n", i, item.Url)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var kittiTestBox3d = ParseBox3d(map[string]interface{}{
+	"position": []interface{}{1., 2., 3.},
+	"rotation": []interface{}{0., 0., 0.5},
+	"scale":    []interface{}{4., 2., 1.5},
+})
+
+// Exports the items and reads back the files of the zip archive
+func exportKittiFiles(t *testing.T, itemType string,
+	items []ItemExport) map[string]string {
+	project := Project{Options: ProjectOptions{ItemType: itemType}}
+	buf := new(bytes.Buffer)
+	err := kittiExporter{}.Export(buf, project, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()),
+		int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(contents)
+	}
+	return files
+}
+
+func TestKittiObjects(t *testing.T) {
+	items := []ItemExport{
+		{Url: "0.ply", Labels: []LabelExport{
+			{Id: 0, Category: "vehicle,car", Box3d: kittiTestBox3d}}},
+		{Url: "1.ply"},
+	}
+	files := exportKittiFiles(t, "pointcloud", items)
+	expected := "car 0 0 -10 -1 -1 -1 -1 1.500000 2.000000 4.000000 " +
+		"1.000000 2.000000 3.000000 0.500000\n"
+	if files["label_2/000000.txt"] != expected {
+		t.Error("expected", expected, "got", files["label_2/000000.txt"])
+	}
+	if contents, ok := files["label_2/000001.txt"]; !ok || contents != "" {
+		t.Error("expected an empty label file for the second frame")
+	}
+	if !strings.Contains(files["frame_map.txt"], "000001 1.ply") {
+		t.Error("missing frame map entry, got", files["frame_map.txt"])
+	}
+}
+
+func TestKittiTracking(t *testing.T) {
+	items := []ItemExport{
+		{VideoName: "a", Index: 1, Labels: []LabelExport{
+			{Id: 7, Category: "car", Box3d: kittiTestBox3d}}},
+		{VideoName: "a", Index: 0, Labels: []LabelExport{
+			{Id: 7, Category: "car", Box3d: kittiTestBox3d}}},
+		{VideoName: "b", Index: 0},
+	}
+	files := exportKittiFiles(t, "pointcloudtracking", items)
+	lines := strings.Split(strings.TrimSpace(files["label_02/0000.txt"]), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "0 7 car ") ||
+		!strings.HasPrefix(lines[1], "1 7 car ") {
+		t.Error("wrong tracking labels", lines)
+	}
+	if files["sequence_map.txt"] != "0000 a\n0001 b\n" {
+		t.Error("wrong sequence map", files["sequence_map.txt"])
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default time in seconds for which a lock is held without a heartbeat
+const defaultLockLease = 60
+
+//implements Serializable
+type TaskLock struct {
+	ProjectName string `json:"projectName" yaml:"projectName"`
+	TaskIndex   int    `json:"taskIndex" yaml:"taskIndex"`
+	// user editing the task, empty if the task is not locked
+	WorkerId string `json:"workerId" yaml:"workerId"`
+	// labeling session holding the lock, empty if the task was opened but
+	// its session is not loaded yet
+	SessionId  string `json:"sessionId" yaml:"sessionId"`
+	LockTime   int64  `json:"lockTime" yaml:"lockTime"`
+	ExpireTime int64  `json:"expireTime" yaml:"expireTime"`
+}
+
+func (lock *TaskLock) GetKey() string {
+	return path.Join(lock.ProjectName, "locks", Index2str(lock.TaskIndex))
+}
+
+func (lock *TaskLock) GetFields() map[string]interface{} {
+	return map[string]interface{}{
+		"ProjectName": lock.ProjectName,
+		"TaskIndex":   lock.TaskIndex,
+		"WorkerId":    lock.WorkerId,
+		"SessionId":   lock.SessionId,
+		"LockTime":    lock.LockTime,
+		"ExpireTime":  lock.ExpireTime,
+	}
+}
+
+// Checks if the task is locked by a session whose lease did not expire
+func (lock *TaskLock) isActive(now int64) bool {
+	return lock.WorkerId != "" && lock.ExpireTime > now
+}
+
+// Checks if a labeling session of a worker may edit the task. A lock taken
+// when the worker opened the task goes to the first session of the worker.
+func (lock *TaskLock) allows(workerId string, sessionId string,
+	now int64) bool {
+	if !lock.isActive(now) {
+		return true
+	}
+	return lock.WorkerId == workerId &&
+		(lock.SessionId == sessionId || lock.SessionId == "")
+}
+
+// Lock of a task as reported to a labeling session
+type TaskLockResponse struct {
+	Lock TaskLock `json:"lock"`
+	// the session may only view the task, the lock holder is editing it
+	ReadOnly bool `json:"readOnly"`
+	// name of the user holding the lock of a read-only session
+	LockHolder string `json:"lockHolder,omitempty"`
+}
+
+// Error of a save by a session which does not hold the lock of the task
+type TaskLockedError struct {
+	Lock TaskLock
+}
+
+func (e *TaskLockedError) Error() string {
+	return fmt.Sprintf("Task %d of %s is locked by %s", e.Lock.TaskIndex,
+		e.Lock.ProjectName, userName(e.Lock.WorkerId))
+}
+
+// locks are read and written together, so a task is never locked twice
+var lockMutex sync.Mutex
+
+// Gets the lock of a task, tasks without a lock are not locked
+func GetTaskLock(projectName string, taskIndex int) (TaskLock, error) {
+	lock := TaskLock{ProjectName: projectName, TaskIndex: taskIndex}
+	fields, err := storage.Load(lock.GetKey())
+	if err != nil {
+		if _, ok := err.(*NotExistError); ok {
+			return lock, nil
+		}
+		return lock, err
+	}
+	err = mapstructure.Decode(fields, &lock)
+	return lock, err
+}
+
+// Lease of the locks in seconds
+func lockLease() int64 {
+	if env.LockLease > 0 {
+		return int64(env.LockLease)
+	}
+	return defaultLockLease
+}
+
+// Locks a task for a labeling session of a worker, or renews the lock of
+// the session. Returns false with the current lock if another session
+// holds it.
+func AcquireTaskLock(projectName string, taskIndex int, workerId string,
+	sessionId string) (TaskLock, bool, error) {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+	lock, err := GetTaskLock(projectName, taskIndex)
+	if err != nil {
+		return lock, false, err
+	}
+	now := recordTimestamp()
+	if !lock.allows(workerId, sessionId, now) {
+		return lock, false, nil
+	}
+	if !lock.isActive(now) {
+		lock.LockTime = now
+	}
+	lock.WorkerId = workerId
+	lock.SessionId = sessionId
+	lock.ExpireTime = now + lockLease()
+	return lock, true, storage.Save(lock.GetKey(), lock.GetFields())
+}
+
+// Releases the lock of a task held by a labeling session
+func ReleaseTaskLock(projectName string, taskIndex int, workerId string,
+	sessionId string) (bool, error) {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+	lock, err := GetTaskLock(projectName, taskIndex)
+	if err != nil {
+		return false, err
+	}
+	if !lock.isActive(recordTimestamp()) {
+		return true, nil
+	}
+	if lock.WorkerId != workerId || lock.SessionId != sessionId {
+		return false, nil
+	}
+	return true, storage.Delete(lock.GetKey())
+}
+
+// Releases the lock of a task whoever holds it
+func ForceUnlockTask(projectName string, taskIndex int) error {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+	lock := TaskLock{ProjectName: projectName, TaskIndex: taskIndex}
+	if !storage.HasKey(lock.GetKey()) {
+		return nil
+	}
+	return storage.Delete(lock.GetKey())
+}
+
+// Checks if a labeling session of a worker may save a task
+func canSaveTask(projectName string, taskIndex int, workerId string,
+	sessionId string) bool {
+	err := checkTaskLock(projectName, taskIndex, workerId, sessionId)
+	if err != nil {
+		if _, ok := err.(*TaskLockedError); !ok {
+			Error.Println(err)
+		}
+		return false
+	}
+	return true
+}
+
+// Checks that a labeling session of a worker may save a task, the save is
+// rejected with a TaskLockedError if another session holds the lock
+func checkTaskLock(projectName string, taskIndex int, workerId string,
+	sessionId string) error {
+	lock, err := GetTaskLock(projectName, taskIndex)
+	if err != nil {
+		return err
+	}
+	if !lock.allows(workerId, sessionId, recordTimestamp()) {
+		return &TaskLockedError{lock}
+	}
+	return nil
+}
+
+// Writes the lock of the task with a locked status if a save is rejected
+// because of a TaskLockedError
+func writeTaskLocked(w http.ResponseWriter, err error) bool {
+	locked, ok := err.(*TaskLockedError)
+	if !ok {
+		return false
+	}
+	w.WriteHeader(http.StatusLocked)
+	writeTaskLockResponse(w, locked.Lock, false)
+	return true
+}
+
+// Writes the lock of a task to a session, which is read-only unless it
+// holds the lock
+func writeTaskLockResponse(w http.ResponseWriter, lock TaskLock,
+	acquired bool) {
+	response := TaskLockResponse{Lock: lock, ReadOnly: !acquired}
+	if !acquired {
+		response.LockHolder = userName(lock.WorkerId)
+	}
+	responseJson, err := json.Marshal(response)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(responseJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
+
+// Gets the task of a lock request
+func getLockRequest(w http.ResponseWriter, r *http.Request) (string, int,
+	bool) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return "", 0, false
+	}
+	taskIndex, err := strconv.Atoi(r.FormValue("task_index"))
+	if err != nil {
+		http.Error(w, "Invalid task_index", http.StatusBadRequest)
+		return "", 0, false
+	}
+	return r.FormValue("project_name"), taskIndex, true
+}
+
+// Handles the heartbeats of the labeling sessions, which renew their locks.
+// Sessions without the lock get the lock holder and stay read-only.
+func postTaskLockHandler(w http.ResponseWriter, r *http.Request) {
+	projectName, taskIndex, ok := getLockRequest(w, r)
+	if !ok {
+		return
+	}
+	lock, acquired, err := AcquireTaskLock(projectName, taskIndex,
+		getWorkerId(r), r.FormValue("session_id"))
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeTaskLockResponse(w, lock, acquired)
+}
+
+// Handles the release of a lock by the labeling session holding it
+func postReleaseTaskLockHandler(w http.ResponseWriter, r *http.Request) {
+	projectName, taskIndex, ok := getLockRequest(w, r)
+	if !ok {
+		return
+	}
+	released, err := ReleaseTaskLock(projectName, taskIndex, getWorkerId(r),
+		r.FormValue("session_id"))
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !released {
+		http.Error(w, "The task is locked by another session",
+			http.StatusConflict)
+	}
+}
+
+// Handles the release of the lock of a task by an admin
+func postForceUnlockHandler(w http.ResponseWriter, r *http.Request) {
+	projectName, taskIndex, ok := getLockRequest(w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can unlock tasks", http.StatusForbidden)
+		return
+	}
+	err := ForceUnlockTask(projectName, taskIndex)
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const lockTestProject = "scalabel_lock_test"
+
+func TestTaskLock(t *testing.T) {
+	defer deleteTestProject(t, lockTestProject)
+	// the lock taken when alice opens the task goes to her first session
+	_, acquired, err := AcquireTaskLock(lockTestProject, 0, "alice", "")
+	if err != nil || !acquired {
+		t.Fatal("expected the task to be locked", err)
+	}
+	lock, acquired, err := AcquireTaskLock(lockTestProject, 0, "alice", "s1")
+	if err != nil || !acquired || lock.SessionId != "s1" {
+		t.Fatal("expected the first session to get the lock", lock, err)
+	}
+	for _, holder := range [][]string{{"alice", "s2"}, {"bob", "s3"},
+		{"bob", ""}} {
+		lock, acquired, err = AcquireTaskLock(lockTestProject, 0, holder[0],
+			holder[1])
+		if err != nil || acquired || lock.WorkerId != "alice" {
+			t.Error("expected the task to stay locked by alice", holder, lock)
+		}
+	}
+	if canSaveTask(lockTestProject, 0, "alice", "s2") ||
+		!canSaveTask(lockTestProject, 0, "alice", "s1") {
+		t.Error("expected only the lock holder to save")
+	}
+	released, err := ReleaseTaskLock(lockTestProject, 0, "bob", "s3")
+	if err != nil || released {
+		t.Error("expected the lock to be released only by its holder")
+	}
+	released, err = ReleaseTaskLock(lockTestProject, 0, "alice", "s1")
+	if err != nil || !released {
+		t.Fatal("expected the lock to be released", err)
+	}
+	_, acquired, err = AcquireTaskLock(lockTestProject, 0, "bob", "s3")
+	if err != nil || !acquired {
+		t.Error("expected the released task to be locked by bob", err)
+	}
+}
+
+// Posts a lock request of the first task
+func postTestLockRequest(t *testing.T, handler http.HandlerFunc,
+	sessionId string) *httptest.ResponseRecorder {
+	form := url.Values{"project_name": {lockTestProject},
+		"task_index": {"0"}, "session_id": {sessionId}}
+	req, err := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestTaskLockHandlers(t *testing.T) {
+	saveTestProject(t, lockTestProject, [][]Item{{{Url: "a.jpg"}}}, nil)
+	defer deleteTestProject(t, lockTestProject)
+	load := func() Sat {
+		request := []byte(`{"task": {"index": 0, "projectOptions": ` +
+			`{"name": "` + lockTestProject + `"}}}`)
+		req, err := http.NewRequest("POST", "postLoadAssignmentV2",
+			bytes.NewReader(request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		postLoadAssignmentV2Handler(rr, req)
+		sat := Sat{}
+		err = json.Unmarshal(rr.Body.Bytes(), &sat)
+		if err != nil {
+			t.Fatal(err, rr.Body.String())
+		}
+		return sat
+	}
+	first := load()
+	second := load()
+	if first.Session.ReadOnly || !second.Session.ReadOnly ||
+		second.Session.LockHolder != DefaultWorker {
+		t.Fatal("expected the second session to be read-only",
+			first.Session, second.Session)
+	}
+
+	// the heartbeat of the read-only session does not take the lock
+	rr := postTestLockRequest(t, postTaskLockHandler, second.Session.SessionId)
+	response := TaskLockResponse{}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil || !response.ReadOnly ||
+		response.Lock.SessionId != first.Session.SessionId {
+		t.Error("wrong heartbeat response", rr.Body.String())
+	}
+	rr = postTestLockRequest(t, postForceUnlockHandler, "")
+	if rr.Code != 200 {
+		t.Fatal("Force unlock handler HTTP code:", rr.Code)
+	}
+	rr = postTestLockRequest(t, postTaskLockHandler, second.Session.SessionId)
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil || response.ReadOnly {
+		t.Error("expected the unlocked task to be locked by the heartbeat",
+			rr.Body.String())
+	}
+	if canSaveTask(lockTestProject, 0, DefaultWorker,
+		first.Session.SessionId) {
+		t.Error("expected the first session to lose the lock")
+	}
+
+	// saves of the session without the lock get the lock holder as json
+	first.Task.Config.SubmitTime = 0
+	satJson, err := json.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "postSaveV2",
+		bytes.NewReader(satJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	postSaveV2Handler(rr, req)
+	response = TaskLockResponse{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if rr.Code != http.StatusLocked || err != nil || !response.ReadOnly ||
+		response.LockHolder != DefaultWorker {
+		t.Error("wrong locked save response", rr.Code, rr.Body.String())
+	}
+	delta := SatDelta{ProjectName: lockTestProject, TaskId: Index2str(0),
+		WorkerId: DefaultWorker, SessionId: first.Session.SessionId,
+		BaseRevision: first.Revision}
+	_, err = SaveSatDelta(delta)
+	if _, ok := err.(*TaskLockedError); !ok {
+		t.Error("expected the delta save to be locked, got", err)
+	}
+	delta.SessionId = second.Session.SessionId
+	_, err = SaveSatDelta(delta)
+	if err != nil {
+		t.Error("expected the lock holder to save, got", err)
+	}
+}
+
+func TestUserName(t *testing.T) {
+	Users["lock_test_user"] = &User{Id: "lock_test_user",
+		Email: "user@example.com"}
+	defer delete(Users, "lock_test_user")
+	if name := userName("lock_test_user"); name != "user@example.com" {
+		t.Error("expected the email of a user without name, got", name)
+	}
+	Users["lock_test_user"].Name = "Test User"
+	if name := userName("lock_test_user"); name != "Test User" {
+		t.Error("expected the name of the user, got", name)
+	}
+	if name := userName("unknown"); name != "unknown" {
+		t.Error("expected the id of an unknown user, got", name)
+	}
+}
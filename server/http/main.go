@@ -25,6 +25,10 @@ var (
 	// Error logs errors
 	Error      *log.Logger
 	configPath string
+	// config of the storage to migrate the labels to
+	migrateConfig string
+	// only count the keys to migrate
+	dryRun bool
 )
 
 // Env stores the config info found in config.yml
@@ -46,6 +50,18 @@ type Env struct {
 	AWSTokenUrl    string `yaml:"awsTokenURL"`
 	AwsJwkUrl      string `yaml:"awsJwkUrl"`
 	UserPoolId     string `yaml:"userPoolID"`
+	ExportWorkers  int    `yaml:"exportWorkers"`
+	ClaimLease     int    `yaml:"claimLease"`
+	// time in seconds for which a finished export job is kept
+	ExportJobTtl int `yaml:"exportJobTtl"`
+	// revisions of the submissions kept by the compaction
+	Retention RetentionPolicy `yaml:"retention"`
+	// number of delta saves after which a full snapshot is saved
+	SnapshotDeltas int `yaml:"snapshotDeltas"`
+	// time in seconds for which a task is locked without a heartbeat
+	LockLease int `yaml:"lockLease"`
+	// read cache of the storage
+	Cache CacheConfig `yaml:"cache"`
 }
 
 func (env Env) AppDir() string {
@@ -112,8 +128,12 @@ func Init(
 		"ERROR: ",
 		log.Ldate|log.Ltime)
 
-	// Handle the flags (right now only have config path)
+	// Handle the flags
 	flag.StringVar(&configPath, "config", "", "Path to config.yml")
+	flag.StringVar(&migrateConfig, "migrate-to", "",
+		"Path to the config.yml of the storage to migrate the labels to")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Count the keys to migrate without copying them")
 	flag.Parse()
 	if configPath == "" {
 		log.Fatal("Must include --config flag with path to config.yml")
@@ -122,6 +142,11 @@ func Init(
 
 // Initialize the environment from the config file
 func NewEnv() *Env {
+	return readEnv(configPath)
+}
+
+// Reads the environment of a config file
+func readEnv(configPath string) *Env {
 	env := new(Env)
 	// read config file
 	cfg, err := ioutil.ReadFile(filepath.Clean(configPath))
@@ -149,6 +174,12 @@ func InitStorage(database string, dir string) Storage {
 		newStorage = &DynamodbStorage{}
 	case "local":
 		newStorage = &FileStorage{}
+	case "sqlite":
+		newStorage = &SqlStorage{Driver: "sqlite3"}
+	case "postgres":
+		newStorage = &SqlStorage{Driver: "postgres"}
+	case "memory":
+		newStorage = &InMemoryStorage{}
 	default:
 		Error.Panic(fmt.Sprintf("Unknown database %s", database))
 	}
@@ -170,6 +201,16 @@ func main() {
 
 	env = *NewEnv()
 	storage = InitStorage(env.Database, env.DataDir)
+	if migrateConfig != "" {
+		os.Exit(runMigration(migrateConfig, dryRun))
+	}
+	if env.Cache.Size > 0 {
+		storage = NewCachedStorage(storage, env.Cache)
+	}
+	StartExportWorkers(env.ExportWorkers)
+	StartCompaction(env.Retention)
+	collabHub := newCollabHub()
+	go collabHub.run()
 
 	// flow control handlers
 	//http.HandleFunc("/", parse(indexHandler))
@@ -181,10 +222,35 @@ func main() {
 	//http.HandleFunc("/postSatProject", WrapHandleFunc(postSatProjectHandler))
 	http.HandleFunc("/postSave", WrapHandleFunc(postSaveHandler))
 	http.HandleFunc("/postSaveV2", WrapHandleFunc(postSaveV2Handler))
+	http.HandleFunc("/postSaveDeltaV2",
+		WrapHandleFunc(postSaveDeltaV2Handler))
+	http.HandleFunc("/taskLock", WrapHandleFunc(postTaskLockHandler))
+	http.HandleFunc("/releaseTaskLock",
+		WrapHandleFunc(postReleaseTaskLockHandler))
+	http.HandleFunc("/forceUnlock", WrapHandleFunc(postForceUnlockHandler))
+	http.HandleFunc("/cacheStats", WrapHandleFunc(getCacheStatsHandler))
+	http.HandleFunc("/collab", WrapHandleFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			collabHandler(collabHub, w, r)
+		}))
 	http.HandleFunc("/postExport", WrapHandleFunc(postExportHandler))
 	http.HandleFunc("/postExportV2", WrapHandleFunc(postExportV2Handler))
+	http.HandleFunc("/exportFormats", WrapHandleFunc(getExportFormatsHandler))
+	http.HandleFunc("/exportJobs", WrapHandleFunc(postExportJobsHandler))
+	http.HandleFunc("/exportJobs/", WrapHandleFunc(getExportJobHandler))
 	http.HandleFunc("/postDownloadTaskURL",
 		WrapHandleFunc(downloadTaskUrlHandler))
+	http.HandleFunc("/assignTasks", WrapHandleFunc(postAssignTasksHandler))
+	http.HandleFunc("/claimTask", WrapHandleFunc(postClaimTaskHandler))
+	http.HandleFunc("/review", WrapHandleFunc(getReviewHandler))
+	http.HandleFunc("/postReview", WrapHandleFunc(postReviewHandler))
+	http.HandleFunc("/agreement", WrapHandleFunc(getAgreementHandler))
+	http.HandleFunc("/workerScores", WrapHandleFunc(getWorkerScoresHandler))
+	http.HandleFunc("/revisions", WrapHandleFunc(getRevisionsHandler))
+	http.HandleFunc("/revision", WrapHandleFunc(getRevisionHandler))
+	http.HandleFunc("/revisionDiff", WrapHandleFunc(getRevisionDiffHandler))
+	http.HandleFunc("/revertRevision",
+		WrapHandleFunc(postRevertRevisionHandler))
 	http.HandleFunc("/postLoadAssignment",
 		WrapHandleFunc(postLoadAssignmentHandler))
 	http.HandleFunc("/postLoadAssignmentV2",
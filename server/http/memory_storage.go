@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//implement Storage interface
+type InMemoryStorage struct {
+	// saved fields as json, so that loads get copies decoded like the
+	// files of the file storage
+	data map[string][]byte
+	lock sync.RWMutex
+	// number of saves and loads left before the one which fails, 0 if no
+	// failure is injected
+	saveFault int
+	loadFault int
+}
+
+// Error of a save or a load failed on purpose
+type InjectedFaultError struct {
+	operation string
+	key       string
+}
+
+func (e *InjectedFaultError) Error() string {
+	return fmt.Sprintf("Injected failure of the %s of %s", e.operation, e.key)
+}
+
+// The storage keeps nothing, so the path is not used
+func (ms *InMemoryStorage) Init(path string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.data = map[string][]byte{}
+	return nil
+}
+
+// Makes the nth save from now fail, 1 being the next one
+func (ms *InMemoryStorage) FailNthSave(n int) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.saveFault = n
+}
+
+// Makes the nth load from now fail, 1 being the next one
+func (ms *InMemoryStorage) FailNthLoad(n int) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.loadFault = n
+}
+
+// Counts down to an injected failure, returns true when it is due
+func countFault(fault *int) bool {
+	if *fault <= 0 {
+		return false
+	}
+	*fault--
+	return *fault == 0
+}
+
+func (ms *InMemoryStorage) HasKey(key string) bool {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	_, ok := ms.data[key]
+	return ok
+}
+
+// Lists the keys and the directories of keys directly under prefix, like
+// the files of a directory in the file storage
+func (ms *InMemoryStorage) ListKeys(prefix string) []string {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	keys := []string{}
+	for key := range ms.data {
+		if prefix == "" || strings.HasPrefix(key, prefix+"/") {
+			keys = append(keys, key)
+		}
+	}
+	return childKeys(prefix, keys)
+}
+
+func (ms *InMemoryStorage) Save(key string,
+	fields map[string]interface{}) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if countFault(&ms.saveFault) {
+		return &InjectedFaultError{"save", key}
+	}
+	fieldsJson, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	ms.data[key] = fieldsJson
+	return nil
+}
+
+func (ms *InMemoryStorage) Load(key string) (map[string]interface{},
+	error) {
+	// the fault countdown is written by loads too
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	var fields map[string]interface{}
+	if countFault(&ms.loadFault) {
+		return fields, &InjectedFaultError{"load", key}
+	}
+	fieldsJson, ok := ms.data[key]
+	if !ok {
+		return fields, &NotExistError{key}
+	}
+	err := json.Unmarshal(fieldsJson, &fields)
+	return fields, err
+}
+
+// Deletes a key and the keys under it, like a file and its directory in the
+// file storage
+func (ms *InMemoryStorage) Delete(key string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	for savedKey := range ms.data {
+		if savedKey == key || strings.HasPrefix(savedKey, key+"/") {
+			delete(ms.data, savedKey)
+		}
+	}
+	return nil
+}
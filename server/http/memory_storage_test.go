@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestInMemoryStorage(t *testing.T) {
+	memoryStorage := &InMemoryStorage{}
+	err := memoryStorage.Init("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"p/tasks/000001", "p/tasks/000000",
+		"p/submissions/000000/alice/9", "p/project", "q/project"} {
+		err = memoryStorage.Save(key, map[string]interface{}{"Index": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := memoryStorage.ListKeys("p"); !reflect.DeepEqual(keys,
+		[]string{"p/project", "p/submissions", "p/tasks"}) {
+		t.Error("wrong keys", keys)
+	}
+	if keys := memoryStorage.ListKeys(""); !reflect.DeepEqual(keys,
+		[]string{"p", "q"}) {
+		t.Error("wrong keys", keys)
+	}
+
+	// loads get copies decoded from json
+	fields, err := memoryStorage.Load("p/project")
+	if err != nil || fields["Index"] != 1.0 {
+		t.Fatal("wrong fields", fields, err)
+	}
+	fields["Index"] = 2
+	fields, _ = memoryStorage.Load("p/project")
+	if fields["Index"] != 1.0 {
+		t.Error("expected the saved fields to be unchanged, got", fields)
+	}
+
+	memoryStorage.FailNthLoad(2)
+	_, err = memoryStorage.Load("p/project")
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = memoryStorage.Load("p/project")
+	if _, ok := err.(*InjectedFaultError); !ok {
+		t.Error("expected the second load to fail, got", err)
+	}
+	_, err = memoryStorage.Load("p/project")
+	if err != nil {
+		t.Error("expected only one load to fail, got", err)
+	}
+
+	err = memoryStorage.Delete("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memoryStorage.HasKey("p/tasks/000000") || !memoryStorage.HasKey(
+		"q/project") {
+		t.Error("expected only the keys under p to be deleted")
+	}
+}
+
+func TestHandlerSaveFault(t *testing.T) {
+	savedStorage := storage
+	memoryStorage := &InMemoryStorage{}
+	err := memoryStorage.Init("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage = memoryStorage
+	defer func() {
+		storage = savedStorage
+	}()
+	memoryStorage.FailNthSave(1)
+	rr := postTestLockRequest(t, postTaskLockHandler, "s1")
+	if rr.Code != http.StatusInternalServerError {
+		t.Error("expected the failed save to be reported, got", rr.Code)
+	}
+	rr = postTestLockRequest(t, postTaskLockHandler, "s1")
+	if rr.Code != 200 {
+		t.Error("expected the next save to succeed, got", rr.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Counts of the keys of a project handled by a migration
+type MigrationCounts struct {
+	// keys copied, or to copy in a dry run
+	Copied int
+	// keys already in the destination with the same content
+	Skipped int
+	// keys which could not be copied or verified
+	Failed int
+}
+
+// Copies every key of the source storage to the destination storage and
+// returns the counts per project. Keys already in the destination with the
+// same content are skipped, so an interrupted migration resumes by running
+// it again. A dry run only counts the keys.
+func MigrateStorage(source Storage, destination Storage,
+	dryRun bool) map[string]*MigrationCounts {
+	counts := map[string]*MigrationCounts{}
+	for _, key := range listAllKeys(source) {
+		projectName := strings.SplitN(key, "/", 2)[0]
+		if counts[projectName] == nil {
+			counts[projectName] = &MigrationCounts{}
+		}
+		copied, err := migrateKey(source, destination, key, dryRun)
+		switch {
+		case err != nil:
+			Error.Println(err)
+			counts[projectName].Failed++
+		case copied:
+			counts[projectName].Copied++
+		default:
+			counts[projectName].Skipped++
+		}
+	}
+	return counts
+}
+
+// Copies a key unless the destination has the same content, and verifies
+// the copy. Returns whether the key is copied.
+func migrateKey(source Storage, destination Storage, key string,
+	dryRun bool) (bool, error) {
+	fields, err := source.Load(key)
+	if err != nil {
+		return false, err
+	}
+	// the checksum is taken before saving, since some storages add fields
+	checksum, err := fieldsChecksum(fields)
+	if err != nil {
+		return false, err
+	}
+	if destination.HasKey(key) {
+		savedChecksum, err := loadChecksum(destination, key)
+		if err == nil && savedChecksum == checksum {
+			return false, nil
+		}
+	}
+	if dryRun {
+		return true, nil
+	}
+	err = destination.Save(key, fields)
+	if err != nil {
+		return false, err
+	}
+	savedChecksum, err := loadChecksum(destination, key)
+	if err != nil {
+		return false, err
+	}
+	if savedChecksum != checksum {
+		return false, fmt.Errorf("Checksum mismatch of %s after copying", key)
+	}
+	return true, nil
+}
+
+// Checksum of the content of a key. Maps are encoded with sorted keys, so
+// equal fields have the same checksum.
+func fieldsChecksum(fields map[string]interface{}) (string, error) {
+	fieldsJson, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(fieldsJson)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func loadChecksum(s Storage, key string) (string, error) {
+	fields, err := s.Load(key)
+	if err != nil {
+		return "", err
+	}
+	return fieldsChecksum(fields)
+}
+
+// Lists every key of a storage in order. Some storages list the keys and
+// the directories of keys directly under a prefix, others all the keys
+// under it.
+func listAllKeys(s Storage) []string {
+	found := map[string]bool{}
+	listed := map[string]bool{}
+	var walk func(prefix string)
+	walk = func(prefix string) {
+		if listed[prefix] {
+			return
+		}
+		listed[prefix] = true
+		parent := prefix
+		if parent == "" {
+			parent = "."
+		}
+		for _, key := range s.ListKeys(prefix) {
+			key = listedKey(s, key)
+			if path.Dir(key) != parent {
+				found[key] = true
+				continue
+			}
+			// a direct child is a key, a directory of keys or both
+			if s.HasKey(key) {
+				found[key] = true
+			}
+			walk(key)
+		}
+	}
+	walk("")
+	keys := []string{}
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Gets the key of a listed key. The S3 storage lists the keys with its
+// data directory.
+func listedKey(s Storage, key string) string {
+	prefixed, ok := unwrapStorage(s).(prefixedStorage)
+	if ok && prefixed.listedPrefix() != "" {
+		return strings.TrimPrefix(key, prefixed.listedPrefix()+"/")
+	}
+	return key
+}
+
+// Migrates the storage to the storage of another config file and prints
+// the counts per project. Returns the exit code of the command.
+func runMigration(destinationConfig string, dryRun bool) int {
+	destinationEnv := readEnv(destinationConfig)
+	if destinationEnv.Database == env.Database &&
+		destinationEnv.DataDir == env.DataDir {
+		Error.Println("Cannot migrate a storage to itself")
+		return 1
+	}
+	destination := InitStorage(destinationEnv.Database,
+		destinationEnv.DataDir)
+	counts := MigrateStorage(storage, destination, dryRun)
+	projectNames := []string{}
+	for projectName := range counts {
+		projectNames = append(projectNames, projectName)
+	}
+	sort.Strings(projectNames)
+	copiedColumn := "copied"
+	if dryRun {
+		copiedColumn = "to copy"
+	}
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "project\t%s\tup to date\tfailed\n", copiedColumn)
+	for _, projectName := range projectNames {
+		projectCounts := counts[projectName]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", projectName,
+			projectCounts.Copied, projectCounts.Skipped,
+			projectCounts.Failed)
+		failed += projectCounts.Failed
+	}
+	w.Flush()
+	if failed > 0 {
+		Error.Printf("%d keys failed to migrate, run the migration again "+
+			"to retry them", failed)
+		return 1
+	}
+	return 0
+}
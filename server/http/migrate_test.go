@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// A storage listing all the keys under a prefix with scans of two keys per
+// page, like the dynamodb storage
+type pagedTestStorage struct {
+	Storage
+	keys  []string
+	pages int
+}
+
+func (s *pagedTestStorage) scan(
+	params *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	s.pages++
+	start := 0
+	if params.ExclusiveStartKey != nil {
+		last := *params.ExclusiveStartKey["Key"].S
+		for start < len(s.keys) && s.keys[start] <= last {
+			start++
+		}
+	}
+	end := Min(start+2, len(s.keys))
+	output := &dynamodb.ScanOutput{}
+	for _, key := range s.keys[start:end] {
+		output.Items = append(output.Items,
+			map[string]*dynamodb.AttributeValue{"Key": {S: aws.String(key)}})
+	}
+	if end < len(s.keys) {
+		output.LastEvaluatedKey = output.Items[len(output.Items)-1]
+	}
+	return output, nil
+}
+
+func (s *pagedTestStorage) ListKeys(prefix string) []string {
+	keys := []string{}
+	for _, key := range scanKeys(s.scan, &dynamodb.ScanInput{}) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestMigrateStorage(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "scalabel_migrate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	source := &FileStorage{}
+	err = source.Init(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{
+		"p1/project",
+		"p1/submissions/000000/alice/9",
+		"p1/tasks/000000",
+		"p1/tasks/000001",
+		"p2/project",
+	}
+	for i, key := range keys {
+		err = source.Save(key, map[string]interface{}{"Index": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if found := listAllKeys(source); !reflect.DeepEqual(found, keys) {
+		t.Fatal("wrong keys", found)
+	}
+	destination := &InMemoryStorage{}
+	err = destination.Init("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a dry run only counts the keys
+	counts := MigrateStorage(source, destination, true)
+	if *counts["p1"] != (MigrationCounts{4, 0, 0}) ||
+		*counts["p2"] != (MigrationCounts{1, 0, 0}) {
+		t.Error("wrong dry run counts", *counts["p1"], *counts["p2"])
+	}
+	if keys := destination.ListKeys(""); len(keys) != 0 {
+		t.Error("expected nothing to be copied, got", keys)
+	}
+
+	// the migration goes on after a failed key
+	destination.FailNthSave(2)
+	counts = MigrateStorage(source, destination, false)
+	if *counts["p1"] != (MigrationCounts{3, 0, 1}) {
+		t.Error("wrong counts", *counts["p1"])
+	}
+	if destination.HasKey("p1/submissions/000000/alice/9") {
+		t.Error("expected the second key not to be copied")
+	}
+
+	// running again copies only the failed key
+	counts = MigrateStorage(source, destination, false)
+	if *counts["p1"] != (MigrationCounts{1, 3, 0}) ||
+		*counts["p2"] != (MigrationCounts{0, 1, 0}) {
+		t.Error("wrong resumed counts", *counts["p1"], *counts["p2"])
+	}
+	for i, key := range keys {
+		fields, err := destination.Load(key)
+		if err != nil || fields["Index"] != float64(i) {
+			t.Error("wrong copy of", key, fields, err)
+		}
+	}
+}
+
+func TestListPagedKeys(t *testing.T) {
+	keys := []string{
+		"p1/project",
+		"p1/submissions/000000/alice/9",
+		"p1/tasks/000000",
+		"p1/tasks/000001",
+		"p2/project",
+	}
+	source := &pagedTestStorage{keys: keys}
+	// the keys of every page are listed
+	if found := listAllKeys(source); !reflect.DeepEqual(found, keys) {
+		t.Error("wrong keys", found)
+	}
+	if source.pages != 3 {
+		t.Error("expected the keys to be listed in 3 pages, got", source.pages)
+	}
+}
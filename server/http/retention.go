@@ -0,0 +1,200 @@
+package main
+
+import (
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default time in seconds between two compactions
+const defaultCompactionInterval = 3600
+
+// RetentionPolicy selects the revisions of a submission kept by the
+// compaction. The latest revision, submitted revisions and reviewed
+// revisions are always kept. Nothing is pruned if no revision count is set.
+type RetentionPolicy struct {
+	// number of latest revisions kept
+	KeepLast int `yaml:"keepLast"`
+	// the last revision of each of the latest hours with revisions is kept
+	KeepHourly int `yaml:"keepHourly"`
+	// the last revision of each of the latest days with revisions is kept
+	KeepDaily int `yaml:"keepDaily"`
+	// time in seconds between two compactions
+	Interval int `yaml:"interval"`
+}
+
+// Checks if the policy prunes any revision
+func (policy RetentionPolicy) isEnabled() bool {
+	return policy.KeepLast > 0 || policy.KeepHourly > 0 || policy.KeepDaily > 0
+}
+
+// Selects the submit times kept by the policy among the times of the
+// revisions of a task sorted from the oldest to the latest. pinned times are
+// always kept.
+func (policy RetentionPolicy) keep(times []int64,
+	pinned map[int64]bool) map[int64]bool {
+	kept := map[int64]bool{}
+	if len(times) == 0 {
+		return kept
+	}
+	for submitTime := range pinned {
+		kept[submitTime] = true
+	}
+	// keeps the last revision of the latest periods with revisions
+	keepPeriods := func(period int64, count int) {
+		lastPeriod := int64(-1)
+		for i := len(times) - 1; i >= 0 && count > 0; i-- {
+			if times[i]/period != lastPeriod {
+				lastPeriod = times[i] / period
+				kept[times[i]] = true
+				count--
+			}
+		}
+	}
+	keepPeriods(1, Max(policy.KeepLast, 1))
+	keepPeriods(3600, policy.KeepHourly)
+	keepPeriods(24*3600, policy.KeepDaily)
+	return kept
+}
+
+// Deletes the revisions of a worker on a task which are not kept by the
+// policy. The snapshots which delta saves are based on are kept as well, so
+// that the delta saves can still be loaded. Returns the number of deleted
+// revisions.
+func compactSubmissions(projectName string, taskIndex int, workerId string,
+	policy RetentionPolicy) (int, error) {
+	// saves of the task are not checked against revisions being deleted
+	unlock := lockTaskSaves(projectName, Index2str(taskIndex), workerId)
+	defer unlock()
+	keys := listSubmissionKeys(projectName, Index2str(taskIndex), workerId)
+	times := []int64{}
+	pinned := map[int64]bool{}
+	for _, key := range keys {
+		submitTime, err := strconv.ParseInt(path.Base(key), 10, 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, submitTime)
+	}
+	for _, key := range listDeltaKeys(projectName, Index2str(taskIndex),
+		workerId) {
+		deltaTime, err := strconv.ParseInt(path.Base(key), 10, 64)
+		if err != nil {
+			continue
+		}
+		// times are sorted, so the last earlier one is the base
+		base := int64(0)
+		for _, submitTime := range times {
+			if submitTime < deltaTime {
+				base = submitTime
+			}
+		}
+		pinned[base] = true
+	}
+	review, err := GetReview(projectName, taskIndex, workerId)
+	if err == nil {
+		pinned[review.SubmitTime] = true
+	} else if _, ok := err.(*NotExistError); !ok {
+		return 0, err
+	}
+	kept := policy.keep(times, pinned)
+	deleted := 0
+	for _, submitTime := range times {
+		if kept[submitTime] {
+			continue
+		}
+		submitted, err := revisionSubmitted(projectName, taskIndex, workerId,
+			submitTime)
+		if err != nil {
+			return deleted, err
+		}
+		if submitted {
+			continue
+		}
+		err = storage.Delete(revisionKey(projectName, taskIndex, workerId,
+			submitTime))
+		if err != nil {
+			return deleted, err
+		}
+		err = storage.Delete(revisionSummaryKey(projectName,
+			Index2str(taskIndex), workerId, submitTime))
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Checks if a revision was submitted. The summary of the revision records it,
+// revisions saved without a summary are only submitted if they are submitted
+// v1 assignments.
+func revisionSubmitted(projectName string, taskIndex int, workerId string,
+	submitTime int64) (bool, error) {
+	fields, err := storage.Load(revisionSummaryKey(projectName,
+		Index2str(taskIndex), workerId, submitTime))
+	if err == nil {
+		revision := Revision{}
+		err = mapstructure.Decode(fields, &revision)
+		return revision.Submitted, err
+	}
+	if _, ok := err.(*NotExistError); !ok {
+		return false, err
+	}
+	fields, err = storage.Load(revisionKey(projectName, taskIndex, workerId,
+		submitTime))
+	if err != nil {
+		return false, err
+	}
+	if _, ok := fields["Task"]; !ok {
+		return false, nil
+	}
+	assignment := Assignment{}
+	err = mapstructure.Decode(fields, &assignment)
+	return assignment.Task.ProjectOptions.Submitted, err
+}
+
+// Compacts the submissions of every task of every project
+func CompactAllSubmissions(policy RetentionPolicy) int {
+	deleted := 0
+	for _, projectName := range GetExistingProjects() {
+		tasks, err := GetTasksInProject(projectName)
+		if err != nil {
+			Error.Println(err)
+			continue
+		}
+		for _, task := range tasks {
+			for _, workerId := range GetTaskWorkers(projectName,
+				Index2str(task.Index)) {
+				n, err := compactSubmissions(projectName, task.Index, workerId,
+					policy)
+				if err != nil {
+					Error.Println(err)
+				}
+				deleted += n
+			}
+		}
+	}
+	return deleted
+}
+
+// StartCompaction starts the goroutine pruning the revisions of the
+// submissions periodically according to the retention policy
+func StartCompaction(policy RetentionPolicy) {
+	if !policy.isEnabled() {
+		return
+	}
+	interval := policy.Interval
+	if interval <= 0 {
+		interval = defaultCompactionInterval
+	}
+	go func() {
+		for {
+			deleted := CompactAllSubmissions(policy)
+			Info.Printf("Compaction deleted %d revisions\n", deleted)
+			time.Sleep(time.Duration(interval) * time.Second)
+		}
+	}()
+}
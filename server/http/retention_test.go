@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+)
+
+const retentionTestProject = "scalabel_retention_test"
+
+func TestRetentionPolicyKeep(t *testing.T) {
+	hour := int64(3600)
+	day := 24 * hour
+	times := []int64{day + 10, day + 20, 2*day + 10, 2*day + hour + 10,
+		2*day + hour + 20, 2*day + hour + 30}
+	policy := RetentionPolicy{KeepLast: 2, KeepHourly: 2, KeepDaily: 2}
+	kept := policy.keep(times, map[int64]bool{10: true})
+	expected := []int64{10, day + 20, 2*day + 10, 2*day + hour + 20,
+		2*day + hour + 30}
+	if len(kept) != len(expected) {
+		t.Error("wrong kept revisions", kept)
+	}
+	for _, submitTime := range expected {
+		if !kept[submitTime] {
+			t.Error("expected", submitTime, "to be kept, got", kept)
+		}
+	}
+	// the latest revision is kept by any policy
+	kept = RetentionPolicy{KeepDaily: 1}.keep([]int64{1, 2}, nil)
+	if len(kept) != 1 || !kept[2] {
+		t.Error("expected the latest revision to be kept, got", kept)
+	}
+}
+
+func TestCompactSubmissions(t *testing.T) {
+	options := ProjectOptions{Name: retentionTestProject}
+	task := Task{ProjectOptions: options, Items: []Item{{Url: "a.jpg"}}}
+	defer deleteTestProject(t, retentionTestProject)
+	for submitTime := int64(1); submitTime <= 5; submitTime++ {
+		submission := Assignment{Task: task, WorkerId: "alice",
+			SubmitTime: submitTime}
+		submission.Task.ProjectOptions.Submitted = submitTime == 2
+		err := storage.Save(submission.GetKey(), submission.GetFields())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	review := Review{ProjectName: retentionTestProject, WorkerId: "alice",
+		SubmitTime: 3, Status: ReviewAccepted}
+	err := storage.Save(review.GetKey(), review.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := compactSubmissions(retentionTestProject, 0, "alice",
+		RetentionPolicy{KeepLast: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the submitted, the reviewed and the latest revisions are kept
+	keys := listSubmissionKeys(retentionTestProject, Index2str(0), "alice")
+	if deleted != 2 || len(keys) != 3 {
+		t.Error("wrong compaction", deleted, keys)
+	}
+}
+
+func TestCompactSatSubmissions(t *testing.T) {
+	defer deleteTestProject(t, retentionTestProject)
+	// times 1 and 3 are full saves, 2 is submitted, 4 is based on 3
+	for submitTime := int64(1); submitTime <= 3; submitTime++ {
+		sat := Sat{Submit: submitTime == 2}
+		sat.Task.Config.ProjectName = retentionTestProject
+		sat.Task.Config.TaskId = Index2str(0)
+		sat.Task.Config.SubmitTime = submitTime
+		sat.User.UserId = "alice"
+		err := storage.Save(sat.GetKey(), sat.GetFields())
+		if err != nil {
+			t.Fatal(err)
+		}
+		saveRevisionSummary(retentionTestProject, Index2str(0),
+			satRevision(sat))
+	}
+	delta := SatDelta{ProjectName: retentionTestProject,
+		TaskId: Index2str(0), WorkerId: "alice", SubmitTime: 4}
+	err := storage.Save(delta.GetKey(), delta.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sat := Sat{}
+	sat.Task.Config.ProjectName = retentionTestProject
+	sat.Task.Config.TaskId = Index2str(0)
+	sat.Task.Config.SubmitTime = 5
+	sat.User.UserId = "alice"
+	err = storage.Save(sat.GetKey(), sat.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := compactSubmissions(retentionTestProject, 0, "alice",
+		RetentionPolicy{KeepLast: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the submitted sat, the base of the delta save and the latest sat are
+	// kept
+	keys := listSubmissionKeys(retentionTestProject, Index2str(0), "alice")
+	if deleted != 1 || len(keys) != 3 {
+		t.Error("wrong compaction", deleted, keys)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Decisions of a review
+const (
+	ReviewAccepted = "accepted"
+	ReviewRejected = "rejected"
+)
+
+// A comment of a reviewer on an item or on one of its labels
+type ReviewComment struct {
+	ItemIndex int `json:"itemIndex" yaml:"itemIndex"`
+	// -1 if the comment is about the whole item
+	LabelId int    `json:"labelId" yaml:"labelId"`
+	Text    string `json:"text" yaml:"text"`
+}
+
+//implements Serializable
+type Review struct {
+	ProjectName string `json:"projectName" yaml:"projectName"`
+	TaskIndex   int    `json:"taskIndex" yaml:"taskIndex"`
+	// worker and submit time of the reviewed submission
+	WorkerId   string          `json:"workerId" yaml:"workerId"`
+	SubmitTime int64           `json:"submitTime" yaml:"submitTime"`
+	ReviewerId string          `json:"reviewerId" yaml:"reviewerId"`
+	Status     string          `json:"status" yaml:"status"`
+	Comment    string          `json:"comment" yaml:"comment"`
+	Comments   []ReviewComment `json:"comments" yaml:"comments"`
+	ReviewTime int64           `json:"reviewTime" yaml:"reviewTime"`
+}
+
+func (review *Review) GetKey() string {
+	return path.Join(review.ProjectName, "reviews",
+		Index2str(review.TaskIndex), review.WorkerId)
+}
+
+func (review *Review) GetFields() map[string]interface{} {
+	return map[string]interface{}{
+		"ProjectName": review.ProjectName,
+		"TaskIndex":   review.TaskIndex,
+		"WorkerId":    review.WorkerId,
+		"SubmitTime":  review.SubmitTime,
+		"ReviewerId":  review.ReviewerId,
+		"Status":      review.Status,
+		"Comment":     review.Comment,
+		"Comments":    review.Comments,
+		"ReviewTime":  review.ReviewTime,
+	}
+}
+
+// Key of the reviewed submission
+func (review *Review) submissionKey() string {
+	return path.Join(review.ProjectName, "submissions",
+		Index2str(review.TaskIndex), review.WorkerId,
+		strconv.FormatInt(review.SubmitTime, 10))
+}
+
+// Submission opened by a reviewer, together with its latest review
+type ReviewContents struct {
+	WorkerId   string                 `json:"workerId"`
+	SubmitTime int64                  `json:"submitTime"`
+	Submission map[string]interface{} `json:"submission"`
+	Review     *Review                `json:"review"`
+}
+
+// Gets the latest review of the task of a worker
+func GetReview(projectName string, taskIndex int,
+	workerId string) (Review, error) {
+	review := Review{ProjectName: projectName, TaskIndex: taskIndex,
+		WorkerId: workerId}
+	fields, err := storage.Load(review.GetKey())
+	if err != nil {
+		return review, err
+	}
+	err = mapstructure.Decode(fields, &review)
+	return review, err
+}
+
+// Checks if the submission of a worker saved at submitTime was accepted
+func isSubmissionAccepted(projectName string, taskIndex int, workerId string,
+	submitTime int64) bool {
+	review, err := GetReview(projectName, taskIndex, workerId)
+	if err != nil {
+		if _, ok := err.(*NotExistError); !ok {
+			Error.Println(err)
+		}
+		return false
+	}
+	return review.Status == ReviewAccepted && review.SubmitTime == submitTime
+}
+
+// Saves a review. A rejected task goes back to its worker: it is saved again
+// as not submitted and assigned to the worker.
+func SubmitReview(review Review) error {
+	if review.Status != ReviewAccepted && review.Status != ReviewRejected {
+		return fmt.Errorf("Unknown review status %s", review.Status)
+	}
+	// the rejected copy is a new revision of the task of the worker
+	unlock := lockTaskSaves(review.ProjectName, Index2str(review.TaskIndex),
+		review.WorkerId)
+	defer unlock()
+	fields, err := storage.Load(review.submissionKey())
+	if err != nil {
+		return err
+	}
+	err = storage.Save(review.GetKey(), review.GetFields())
+	if err != nil {
+		return err
+	}
+	if review.Status != ReviewRejected {
+		return nil
+	}
+	// only v1 assignments have a submitted state, v2 tasks stay open
+	if _, ok := fields["Task"]; ok {
+		assignment := Assignment{}
+		err = mapstructure.Decode(fields, &assignment)
+		if err != nil {
+			return err
+		}
+		assignment.Task.ProjectOptions.Submitted = false
+		assignment.SubmitTime = nextRevisionTime(latestSaveTime(
+			review.ProjectName, Index2str(review.TaskIndex),
+			review.WorkerId))
+		err = storage.Save(assignment.GetKey(), assignment.GetFields())
+		if err != nil {
+			return err
+		}
+		saveRevisionSummary(review.ProjectName, Index2str(review.TaskIndex),
+			assignmentRevision(assignment))
+	}
+	_, err = AssignTasks(review.ProjectName, []int{review.TaskIndex},
+		review.WorkerId)
+	if err != nil {
+		return err
+	}
+	return setTaskSubmitted(review.ProjectName, review.TaskIndex, false)
+}
+
+// Checks if the user sending a request can review tasks. Without user
+// management everyone can.
+func isReviewer(r *http.Request) bool {
+	if isAdmin(r) {
+		return true
+	}
+	user, ok := Users[getWorkerId(r)]
+	return ok && user.Group == "reviewer"
+}
+
+// Handles the loading of a submission with its review. Reviewers choose the
+// worker and the submit time, which default to the latest submission of the
+// task. Workers get the review of their own latest submission.
+func getReviewHandler(w http.ResponseWriter, r *http.Request) {
+	projectName := r.FormValue("project_name")
+	taskIndex, err := strconv.Atoi(r.FormValue("task_index"))
+	if err != nil {
+		http.Error(w, "Invalid task_index", http.StatusBadRequest)
+		return
+	}
+	workerId := getWorkerId(r)
+	if isReviewer(r) {
+		workerId = r.FormValue("worker")
+		if workerId == "" {
+			workerId = getLatestTaskWorker(projectName, Index2str(taskIndex))
+		}
+	}
+	keys := listSubmissionKeys(projectName, Index2str(taskIndex), workerId)
+	if len(keys) == 0 {
+		http.Error(w, "The task has no submission", http.StatusNotFound)
+		return
+	}
+	contents := ReviewContents{WorkerId: workerId}
+	contents.SubmitTime, err = strconv.ParseInt(path.Base(keys[len(keys)-1]),
+		10, 64)
+	if submitTime := r.FormValue("submit_time"); submitTime != "" &&
+		isReviewer(r) {
+		contents.SubmitTime, err = strconv.ParseInt(submitTime, 10, 64)
+	}
+	if err != nil {
+		http.Error(w, "Invalid submit_time", http.StatusBadRequest)
+		return
+	}
+	contents.Submission, err = storage.Load(revisionKey(projectName,
+		taskIndex, workerId, contents.SubmitTime))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	review, err := GetReview(projectName, taskIndex, workerId)
+	if err == nil {
+		contents.Review = &review
+	} else if _, ok := err.(*NotExistError); !ok {
+		Error.Println(err)
+	}
+	contentsJson, err := json.Marshal(contents)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(contentsJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
+
+// Handles the posting of a review
+func postReviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	if !isReviewer(r) {
+		http.Error(w, "Only reviewers can review tasks", http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		Error.Println(err)
+	}
+	review := Review{}
+	err = json.Unmarshal(body, &review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review.ReviewerId = getWorkerId(r)
+	review.ReviewTime = recordTimestamp()
+	err = SubmitReview(review)
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reviewJson, err := json.Marshal(review)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(reviewJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
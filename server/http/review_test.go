@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const reviewTestProject = "scalabel_review_test"
+
+// Saves a submitted task of alice
+func saveReviewTestSubmission(t *testing.T) Project {
+	project, _ := saveTestProject(t, reviewTestProject,
+		[][]Item{{{Url: "a.jpg"}}}, []testSubmission{{workerId: "alice",
+			submitTime: 100, labels: []Label{{Id: 0, CategoryPath: "car"}},
+			submitted: true}})
+	return project
+}
+
+func postReviewTest(t *testing.T, review Review) *httptest.ResponseRecorder {
+	reviewJson, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "/postReview",
+		bytes.NewReader(reviewJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	postReviewHandler(rr, req)
+	return rr
+}
+
+func acceptedTestItems(t *testing.T, project Project) []ItemExport {
+	filter := ExportFilter{TaskEnd: -1, AcceptedOnly: true,
+		IncludeUnlabeled: true}
+	return exportTaskItems(project, Task{Index: 0}, filter)
+}
+
+func TestReview(t *testing.T) {
+	project := saveReviewTestSubmission(t)
+	defer deleteTestProject(t, reviewTestProject)
+	if items := acceptedTestItems(t, project); len(items) != 0 {
+		t.Error("expected no accepted items before the review, got", items)
+	}
+	review := Review{ProjectName: reviewTestProject, WorkerId: "alice",
+		SubmitTime: 100, Status: ReviewAccepted}
+	rr := postReviewTest(t, review)
+	if rr.Code != 200 {
+		t.Fatal("Review handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	if items := acceptedTestItems(t, project); len(items) != 1 {
+		t.Error("expected the accepted item, got", items)
+	}
+
+	review.Status = ReviewRejected
+	review.Comments = []ReviewComment{{ItemIndex: 0, LabelId: 0,
+		Text: "not a car"}}
+	rr = postReviewTest(t, review)
+	if rr.Code != 200 {
+		t.Fatal("Review handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	if items := acceptedTestItems(t, project); len(items) != 0 {
+		t.Error("expected no accepted items after the rejection, got", items)
+	}
+	// the task goes back to alice
+	assignment, err := GetAssignment(reviewTestProject, Index2str(0), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assignment.Task.ProjectOptions.Submitted {
+		t.Error("expected the rejected task to be open again")
+	}
+	claim, err := GetTaskClaim(reviewTestProject, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.AssignedTo != "alice" {
+		t.Error("expected the task to be assigned to alice, got", claim)
+	}
+	// the worker finds the comments of the rejection
+	req, err := http.NewRequest("GET", "/review?project_name="+
+		reviewTestProject+"&task_index=0&worker=alice&submit_time=100", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	getReviewHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Get review handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	contents := ReviewContents{}
+	err = json.Unmarshal(rr.Body.Bytes(), &contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents.SubmitTime != 100 || contents.Review == nil ||
+		contents.Review.Status != ReviewRejected ||
+		len(contents.Review.Comments) != 1 {
+		t.Error("wrong review contents", contents)
+	}
+	// submit times are numbers, not paths to other keys
+	req, err = http.NewRequest("GET", "/review?project_name="+
+		reviewTestProject+"&task_index=0&worker=alice&submit_time="+
+		url.QueryEscape("../../../tasks/000000"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	getReviewHandler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Error("expected an invalid submit_time, got", rr.Code,
+			rr.Body.String())
+	}
+
+	review.SubmitTime = 1
+	rr = postReviewTest(t, review)
+	if rr.Code != http.StatusBadRequest {
+		t.Error("expected the review of a missing submission to fail, got",
+			rr.Code)
+	}
+}
+
+func TestRejectKeepsSubmission(t *testing.T) {
+	project := saveReviewTestSubmission(t)
+	defer deleteTestProject(t, reviewTestProject)
+	// a submission saved in the same second as the rejection
+	submission, err := GetAssignment(reviewTestProject, Index2str(0), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	submission.SubmitTime = recordTimestamp()
+	err = storage.Save(submission.GetKey(), submission.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := Review{ProjectName: reviewTestProject, WorkerId: "alice",
+		SubmitTime: submission.SubmitTime, Status: ReviewRejected}
+	err = SubmitReview(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := ListRevisions(project, 0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 ||
+		revisions[1].SubmitTime != submission.SubmitTime ||
+		!revisions[1].Submitted || revisions[2].Submitted {
+		t.Error("expected the rejection after the submission, got",
+			revisions)
+	}
+}
+
+func TestUserGroup(t *testing.T) {
+	groups := map[string]interface{}{
+		"admin":    []interface{}{"reviewer", "admin"},
+		"reviewer": []interface{}{"reviewer"},
+		"worker":   nil,
+	}
+	for expected, userGroups := range groups {
+		if group := userGroup(userGroups); group != expected {
+			t.Errorf("expected %s for %v, got %s", expected, userGroups,
+				group)
+		}
+	}
+}
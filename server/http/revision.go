@@ -0,0 +1,728 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// A saved submission of a task
+type Revision struct {
+	WorkerId   string `json:"workerId"`
+	SubmitTime int64  `json:"submitTime"`
+	// whether the save was a submission of the task
+	Submitted bool `json:"submitted"`
+	NumLabels int  `json:"numLabels"`
+	// whether the revision is a delta save rather than a snapshot
+	Delta bool `json:"delta"`
+}
+
+// A changed field of a label, such as "box2d.x1" or "attributes.occluded"
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// A label added, removed or modified between two revisions
+type LabelChange struct {
+	ItemIndex int           `json:"itemIndex"`
+	LabelId   int           `json:"labelId"`
+	Category  string        `json:"category"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+// Changes of the labels of a worker between two revisions of a task
+type RevisionDiff struct {
+	WorkerId string        `json:"workerId"`
+	From     int64         `json:"from"`
+	To       int64         `json:"to"`
+	Added    []LabelChange `json:"added"`
+	Removed  []LabelChange `json:"removed"`
+	Modified []LabelChange `json:"modified"`
+}
+
+// Gets the key of a revision
+func revisionKey(projectName string, taskIndex int, workerId string,
+	submitTime int64) string {
+	return path.Join(projectName, "submissions", Index2str(taskIndex),
+		workerId, strconv.FormatInt(submitTime, 10))
+}
+
+// Gets the key of the summary of a revision
+func revisionSummaryKey(projectName string, taskIndex string,
+	workerId string, submitTime int64) string {
+	return path.Join(projectName, "revisionSummaries", taskIndex, workerId,
+		strconv.FormatInt(submitTime, 10))
+}
+
+// Saves the summary of a revision, so that the revisions are listed without
+// loading them. Errors are only logged since revisions without a summary
+// are loaded when they are listed.
+func saveRevisionSummary(projectName string, taskIndex string,
+	revision Revision) {
+	err := storage.Save(revisionSummaryKey(projectName, taskIndex,
+		revision.WorkerId, revision.SubmitTime), map[string]interface{}{
+		"WorkerId":   revision.WorkerId,
+		"SubmitTime": revision.SubmitTime,
+		"Submitted":  revision.Submitted,
+		"NumLabels":  revision.NumLabels,
+		"Delta":      revision.Delta,
+	})
+	if err != nil {
+		Error.Println(err)
+	}
+}
+
+// Summarizes a v1 assignment saved as a revision
+func assignmentRevision(assignment Assignment) Revision {
+	revision := Revision{WorkerId: assignment.WorkerId,
+		SubmitTime: assignment.SubmitTime,
+		Submitted:  assignment.Task.ProjectOptions.Submitted}
+	for _, item := range assignment.Task.Items {
+		revision.NumLabels += len(item.LabelIds)
+	}
+	return revision
+}
+
+// Summarizes a v2 sat saved as a revision
+func satRevision(sat Sat) Revision {
+	revision := Revision{WorkerId: sat.User.UserId,
+		SubmitTime: sat.Task.Config.SubmitTime, Submitted: sat.Submit}
+	for _, item := range sat.Task.Items {
+		revision.NumLabels += len(item.Labels)
+	}
+	return revision
+}
+
+// Loads the revision of a delta save, which is the snapshot before it with
+// the delta saves up to it applied
+func loadDeltaRevision(projectName string, taskIndex string,
+	workerId string, submitTime int64) (Sat, error) {
+	sat := Sat{}
+	snapshotKey := ""
+	for _, key := range listSubmissionKeys(projectName, taskIndex,
+		workerId) {
+		snapshotTime, err := strconv.ParseInt(path.Base(key), 10, 64)
+		if err == nil && snapshotTime < submitTime {
+			snapshotKey = key
+		}
+	}
+	if snapshotKey == "" {
+		assignment := Assignment{}
+		fields, err := storage.Load(path.Join(projectName, "assignments",
+			taskIndex, workerId))
+		if err != nil {
+			return sat, err
+		}
+		err = mapstructure.Decode(fields, &assignment)
+		if err != nil {
+			return sat, err
+		}
+		sat = assignmentToSat(&assignment)
+	} else {
+		fields, err := storage.Load(snapshotKey)
+		if err != nil {
+			return sat, err
+		}
+		satJson, err := json.Marshal(fields)
+		if err != nil {
+			return sat, err
+		}
+		err = json.Unmarshal(satJson, &sat)
+		if err != nil {
+			return sat, err
+		}
+	}
+	err := applyDeltasUntil(&sat, projectName, taskIndex, workerId,
+		submitTime)
+	if err != nil {
+		return sat, err
+	}
+	if sat.Task.Config.SubmitTime != submitTime {
+		return sat, &NotExistError{path.Join(projectName, "deltas",
+			taskIndex, workerId, strconv.FormatInt(submitTime, 10))}
+	}
+	return sat, nil
+}
+
+// Loads a revision, which is a v1 assignment, a v2 sat or a delta save of a
+// v2 sat, and converts it into exported items
+func LoadRevision(project Project, taskIndex int, workerId string,
+	submitTime int64) (map[string]interface{}, []ItemExport, Revision,
+	error) {
+	revision := Revision{WorkerId: workerId, SubmitTime: submitTime}
+	items := []ItemExport{}
+	fields, err := storage.Load(revisionKey(project.Options.Name, taskIndex,
+		workerId, submitTime))
+	delta := SatDelta{ProjectName: project.Options.Name,
+		TaskId: Index2str(taskIndex), WorkerId: workerId,
+		SubmitTime: submitTime}
+	if _, ok := err.(*NotExistError); ok && storage.HasKey(delta.GetKey()) {
+		var sat Sat
+		sat, err = loadDeltaRevision(project.Options.Name,
+			Index2str(taskIndex), workerId, submitTime)
+		fields = sat.GetFields()
+		revision.Delta = true
+	}
+	if err != nil {
+		return fields, items, revision, err
+	}
+	if _, ok := fields["Task"]; ok {
+		assignment := Assignment{}
+		err = mapstructure.Decode(fields, &assignment)
+		if err != nil {
+			return fields, items, revision, err
+		}
+		revision.Submitted = assignment.Task.ProjectOptions.Submitted
+		items = assignmentItemExports(project, assignment)
+	} else {
+		sat := Sat{}
+		satJson, err := json.Marshal(fields)
+		if err != nil {
+			return fields, items, revision, err
+		}
+		err = json.Unmarshal(satJson, &sat)
+		if err != nil {
+			return fields, items, revision, err
+		}
+		task, err := GetTask(project.Options.Name, Index2str(taskIndex))
+		if err != nil {
+			return fields, items, revision, err
+		}
+		for _, item := range satItemExports(project, sat, task) {
+			items = append(items, item.ToItemExport())
+		}
+	}
+	for _, item := range items {
+		revision.NumLabels += len(item.Labels)
+	}
+	return fields, items, revision, nil
+}
+
+// Lists the revisions of a task from the oldest to the latest, including
+// the delta saves. The revisions of all the workers are listed if workerId
+// is empty. Revisions are only loaded if they have no summary.
+func ListRevisions(project Project, taskIndex int,
+	workerId string) ([]Revision, error) {
+	revisions := []Revision{}
+	projectName := project.Options.Name
+	workers := []string{workerId}
+	if workerId == "" {
+		workers = GetTaskWorkers(projectName, Index2str(taskIndex))
+	}
+	for _, worker := range workers {
+		keys := append(listSubmissionKeys(projectName, Index2str(taskIndex),
+			worker), listDeltaKeys(projectName, Index2str(taskIndex),
+			worker)...)
+		for _, key := range keys {
+			submitTime, err := strconv.ParseInt(path.Base(key), 10, 64)
+			if err != nil {
+				Error.Println(err)
+				continue
+			}
+			revision := Revision{}
+			fields, err := storage.Load(revisionSummaryKey(projectName,
+				Index2str(taskIndex), worker, submitTime))
+			if err == nil {
+				err = mapstructure.Decode(fields, &revision)
+			} else if _, ok := err.(*NotExistError); ok {
+				_, _, revision, err = LoadRevision(project, taskIndex, worker,
+					submitTime)
+			}
+			if err != nil {
+				return revisions, err
+			}
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].SubmitTime < revisions[j].SubmitTime
+	})
+	return revisions, nil
+}
+
+// Compares two revisions of a worker. A from time of 0 compares the to
+// revision with an empty task.
+func DiffRevisions(project Project, taskIndex int, workerId string,
+	from int64, to int64) (RevisionDiff, error) {
+	diff := RevisionDiff{WorkerId: workerId, From: from, To: to}
+	fromItems := []ItemExport{}
+	if from != 0 {
+		var err error
+		_, fromItems, _, err = LoadRevision(project, taskIndex, workerId, from)
+		if err != nil {
+			return diff, err
+		}
+	}
+	_, toItems, _, err := LoadRevision(project, taskIndex, workerId, to)
+	if err != nil {
+		return diff, err
+	}
+	diff.Added, diff.Removed, diff.Modified = diffItems(fromItems, toItems)
+	return diff, nil
+}
+
+// Compares the labels of the items of two revisions. Labels are identified
+// by their item and their id.
+func diffItems(fromItems []ItemExport, toItems []ItemExport) ([]LabelChange,
+	[]LabelChange, []LabelChange) {
+	added := []LabelChange{}
+	removed := []LabelChange{}
+	modified := []LabelChange{}
+	for i := 0; i < Max(len(fromItems), len(toItems)); i++ {
+		fromLabels := map[int]LabelExport{}
+		toLabels := map[int]LabelExport{}
+		itemIndex := i
+		if i < len(fromItems) {
+			itemIndex = fromItems[i].Index
+			for _, label := range fromItems[i].Labels {
+				fromLabels[label.Id] = label
+			}
+		}
+		if i < len(toItems) {
+			itemIndex = toItems[i].Index
+			for _, label := range toItems[i].Labels {
+				toLabels[label.Id] = label
+			}
+		}
+		ids := []int{}
+		for id := range fromLabels {
+			ids = append(ids, id)
+		}
+		for id := range toLabels {
+			if _, ok := fromLabels[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			fromLabel, inFrom := fromLabels[id]
+			toLabel, inTo := toLabels[id]
+			change := LabelChange{ItemIndex: itemIndex, LabelId: id,
+				Category: toLabel.Category}
+			switch {
+			case !inFrom:
+				added = append(added, change)
+			case !inTo:
+				change.Category = fromLabel.Category
+				removed = append(removed, change)
+			default:
+				change.Changes = diffLabels(fromLabel, toLabel)
+				if len(change.Changes) > 0 {
+					modified = append(modified, change)
+				}
+			}
+		}
+	}
+	return added, removed, modified
+}
+
+// Lists the changed fields of a label
+func diffLabels(from LabelExport, to LabelExport) []FieldChange {
+	changes := []FieldChange{}
+	if from.Category != to.Category {
+		changes = append(changes, FieldChange{"category", from.Category,
+			to.Category})
+	}
+	if from.ManualShape != to.ManualShape {
+		changes = append(changes, FieldChange{"manualShape", from.ManualShape,
+			to.ManualShape})
+	}
+	changes = append(changes, diffFields("attributes", from.Attributes,
+		to.Attributes)...)
+	changes = append(changes, diffFields("box2d", from.Box2d, to.Box2d)...)
+	changes = append(changes, diffFields("box3d", from.Box3d, to.Box3d)...)
+	if fmt.Sprint(from.Poly2d) != fmt.Sprint(to.Poly2d) {
+		changes = append(changes, FieldChange{"poly2d", from.Poly2d,
+			to.Poly2d})
+	}
+	return changes
+}
+
+// Lists the changed values of two maps, values are compared by their text
+// like attributes in the agreement report
+func diffFields(prefix string, from map[string]interface{},
+	to map[string]interface{}) []FieldChange {
+	keys := []string{}
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	changes := []FieldChange{}
+	for _, key := range keys {
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		if inFrom != inTo || fmt.Sprint(fromValue) != fmt.Sprint(toValue) {
+			changes = append(changes, FieldChange{prefix + "." + key,
+				fromValue, toValue})
+		}
+	}
+	return changes
+}
+
+// Revision made by a save, or the latest revision if the save conflicts
+type SaveResponse struct {
+	Revision int64 `json:"revision"`
+}
+
+// Error of a save based on a revision which is not the latest one
+type RevisionConflictError struct {
+	Latest int64
+}
+
+func (e *RevisionConflictError) Error() string {
+	return fmt.Sprintf("The latest revision is %d", e.Latest)
+}
+
+// Lock of the saves of the task of a worker, shared by the saves waiting
+// for it
+type saveLock struct {
+	lock  sync.Mutex
+	users int
+}
+
+// saves of the task of a worker are checked and applied one at a time, so
+// that no save overwrites another one. Saves of other tasks or workers don't
+// wait for each other.
+var saveLocks = struct {
+	sync.Mutex
+	tasks map[string]*saveLock
+}{tasks: map[string]*saveLock{}}
+
+// Locks the saves of the task of a worker and returns the function
+// unlocking them. The lock is dropped once no save uses it.
+func lockTaskSaves(projectName string, taskIndex string,
+	workerId string) func() {
+	key := path.Join(projectName, taskIndex, workerId)
+	saveLocks.Lock()
+	taskLock, ok := saveLocks.tasks[key]
+	if !ok {
+		taskLock = &saveLock{}
+		saveLocks.tasks[key] = taskLock
+	}
+	taskLock.users++
+	saveLocks.Unlock()
+	taskLock.lock.Lock()
+	return func() {
+		taskLock.lock.Unlock()
+		saveLocks.Lock()
+		taskLock.users--
+		if taskLock.users == 0 {
+			delete(saveLocks.tasks, key)
+		}
+		saveLocks.Unlock()
+	}
+}
+
+// Gets the submit time of the latest save of the task of a worker, or 0 if
+// the worker has not saved the task yet
+func latestSaveTime(projectName string, taskIndex string,
+	workerId string) int64 {
+	var latest int64
+	keys := append(listSubmissionKeys(projectName, taskIndex, workerId),
+		listDeltaKeys(projectName, taskIndex, workerId)...)
+	for _, key := range keys {
+		submitTime, err := strconv.ParseInt(path.Base(key), 10, 64)
+		if err == nil && submitTime > latest {
+			latest = submitTime
+		}
+	}
+	return latest
+}
+
+// Gets the latest revision of the task of a worker, which is the submit time
+// of the latest save, or the start time of the assignment if the worker has
+// not saved the task yet
+func latestRevision(projectName string, taskIndex string,
+	workerId string) (int64, error) {
+	latest := latestSaveTime(projectName, taskIndex, workerId)
+	if latest > 0 {
+		return latest, nil
+	}
+	fields, err := storage.Load(path.Join(projectName, "assignments",
+		taskIndex, workerId))
+	if err != nil {
+		return 0, err
+	}
+	assignment := Assignment{}
+	err = mapstructure.Decode(fields, &assignment)
+	return assignment.StartTime, err
+}
+
+// Checks that a save is based on the latest revision of the task of a worker
+// and returns the submit time of the save. Saves without a base revision
+// are not checked. The saves of the task must be locked until the save is
+// stored.
+func checkRevision(projectName string, taskIndex string, workerId string,
+	base int64) (int64, error) {
+	if base == 0 {
+		return nextRevisionTime(latestSaveTime(projectName, taskIndex,
+			workerId)), nil
+	}
+	latest, err := latestRevision(projectName, taskIndex, workerId)
+	if err != nil {
+		return 0, err
+	}
+	if base != latest {
+		return 0, &RevisionConflictError{latest}
+	}
+	return nextRevisionTime(latest), nil
+}
+
+// Writes the latest revision with a conflict status if a save is rejected
+// because of a RevisionConflictError
+func writeRevisionConflict(w http.ResponseWriter, err error) bool {
+	conflict, ok := err.(*RevisionConflictError)
+	if !ok {
+		return false
+	}
+	w.WriteHeader(http.StatusConflict)
+	writeRevisionResponse(w, SaveResponse{conflict.Latest})
+	return true
+}
+
+// Reverts the task of a worker to an earlier revision by saving a copy of it
+// as the newest revision. Nothing is deleted, so a revert can be reverted
+// too. If the latest revision is a delta save, the latest state is saved as
+// a snapshot of its own before the copy.
+func RevertRevision(project Project, taskIndex int, workerId string,
+	submitTime int64) (Revision, error) {
+	unlock := lockTaskSaves(project.Options.Name, Index2str(taskIndex),
+		workerId)
+	defer unlock()
+	fields, _, revision, err := LoadRevision(project, taskIndex, workerId,
+		submitTime)
+	if err != nil {
+		return revision, err
+	}
+	latest, err := latestRevision(project.Options.Name, Index2str(taskIndex),
+		workerId)
+	if err != nil {
+		return revision, err
+	}
+	revision.SubmitTime = nextRevisionTime(latest)
+	revision.Delta = false
+	if _, ok := fields["Task"]; ok {
+		assignment := Assignment{}
+		err = mapstructure.Decode(fields, &assignment)
+		if err != nil {
+			return revision, err
+		}
+		assignment.SubmitTime = revision.SubmitTime
+		err = storage.Save(assignment.GetKey(), assignment.GetFields())
+		if err == nil {
+			saveRevisionSummary(project.Options.Name, Index2str(taskIndex),
+				assignmentRevision(assignment))
+		}
+		return revision, err
+	}
+	sat := Sat{}
+	satJson, err := json.Marshal(fields)
+	if err != nil {
+		return revision, err
+	}
+	err = json.Unmarshal(satJson, &sat)
+	if err != nil {
+		return revision, err
+	}
+	if latestSaveTime(project.Options.Name, Index2str(taskIndex),
+		workerId) > latestSnapshotTime(project.Options.Name,
+		Index2str(taskIndex), workerId) {
+		current, err := GetSat(project.Options.Name, Index2str(taskIndex),
+			workerId)
+		if err != nil {
+			return revision, err
+		}
+		current.Task.Config.SubmitTime = revision.SubmitTime
+		err = storage.Save(current.GetKey(), current.GetFields())
+		if err != nil {
+			return revision, err
+		}
+		saveRevisionSummary(project.Options.Name, Index2str(taskIndex),
+			satRevision(current))
+		revision.SubmitTime = nextRevisionTime(revision.SubmitTime)
+	}
+	sat.Task.Config.SubmitTime = revision.SubmitTime
+	err = storage.Save(sat.GetKey(), sat.GetFields())
+	if err != nil {
+		return revision, err
+	}
+	saveRevisionSummary(project.Options.Name, Index2str(taskIndex),
+		satRevision(sat))
+	return revision, nil
+}
+
+// Gets the project and the task index of a revision request, and the worker
+// whose revisions are requested. Reviewers may request the revisions of any
+// worker, other workers only their own.
+func getRevisionRequest(w http.ResponseWriter, r *http.Request) (Project,
+	int, string, bool) {
+	project, err := GetProject(r.FormValue("project_name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return project, 0, "", false
+	}
+	taskIndex, err := strconv.Atoi(r.FormValue("task_index"))
+	if err != nil {
+		http.Error(w, "Invalid task_index", http.StatusBadRequest)
+		return project, 0, "", false
+	}
+	workerId := getWorkerId(r)
+	if isReviewer(r) {
+		workerId = r.FormValue("worker")
+	}
+	return project, taskIndex, workerId, true
+}
+
+// Parses a submit time of a revision request
+func parseSubmitTime(w http.ResponseWriter, value string) (int64, bool) {
+	submitTime, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid submit time %s", value),
+			http.StatusBadRequest)
+		return 0, false
+	}
+	return submitTime, true
+}
+
+// Writes the response of a revision request
+func writeRevisionResponse(w http.ResponseWriter, response interface{}) {
+	responseJson, err := json.Marshal(response)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(responseJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
+
+// Handles the list of the revisions of a task. Reviewers get the revisions
+// of all the workers unless they choose a worker.
+func getRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	project, taskIndex, workerId, ok := getRevisionRequest(w, r)
+	if !ok {
+		return
+	}
+	revisions, err := ListRevisions(project, taskIndex, workerId)
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeRevisionResponse(w, revisions)
+}
+
+// Handles the loading of a revision of a task
+func getRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	project, taskIndex, workerId, ok := getRevisionRequest(w, r)
+	if !ok {
+		return
+	}
+	if workerId == "" {
+		workerId = getLatestTaskWorker(project.Options.Name,
+			Index2str(taskIndex))
+	}
+	submitTime, ok := parseSubmitTime(w, r.FormValue("submit_time"))
+	if !ok {
+		return
+	}
+	fields, _, _, err := LoadRevision(project, taskIndex, workerId, submitTime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeRevisionResponse(w, fields)
+}
+
+// Handles the diff between two revisions of a worker. The to revision is
+// the latest by default, and the from revision the one before it.
+func getRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	project, taskIndex, workerId, ok := getRevisionRequest(w, r)
+	if !ok {
+		return
+	}
+	if workerId == "" {
+		workerId = getLatestTaskWorker(project.Options.Name,
+			Index2str(taskIndex))
+	}
+	revisions, err := ListRevisions(project, taskIndex, workerId)
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		http.Error(w, "The task has no revision", http.StatusNotFound)
+		return
+	}
+	to := revisions[len(revisions)-1].SubmitTime
+	if value := r.FormValue("to"); value != "" {
+		if to, ok = parseSubmitTime(w, value); !ok {
+			return
+		}
+	}
+	var from int64
+	for _, revision := range revisions {
+		if revision.SubmitTime < to {
+			from = revision.SubmitTime
+		}
+	}
+	if value := r.FormValue("from"); value != "" {
+		if from, ok = parseSubmitTime(w, value); !ok {
+			return
+		}
+	}
+	diff, err := DiffRevisions(project, taskIndex, workerId, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeRevisionResponse(w, diff)
+}
+
+// Handles the revert of the task of a worker to an earlier revision by an
+// admin
+func postRevertRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can revert tasks", http.StatusForbidden)
+		return
+	}
+	project, taskIndex, workerId, ok := getRevisionRequest(w, r)
+	if !ok {
+		return
+	}
+	if workerId == "" {
+		http.Error(w, "Missing worker", http.StatusBadRequest)
+		return
+	}
+	submitTime, ok := parseSubmitTime(w, r.FormValue("submit_time"))
+	if !ok {
+		return
+	}
+	revision, err := RevertRevision(project, taskIndex, workerId, submitTime)
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	Info.Printf("Reverted task %d of %s by %s to %d\n", taskIndex,
+		project.Options.Name, workerId, submitTime)
+	writeRevisionResponse(w, revision)
+}
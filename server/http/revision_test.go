@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+const revisionTestProject = "scalabel_revision_test"
+
+// Saves three revisions of a task by alice. The times sort differently as
+// text and as numbers.
+func saveRevisionTestSubmissions(t *testing.T) Project {
+	car := map[string]interface{}{"x": 0, "y": 0, "w": 10, "h": 10}
+	truck := map[string]interface{}{"x": 1, "y": 0, "w": 10, "h": 10}
+	person := map[string]interface{}{"x": 5, "y": 5, "w": 1, "h": 1}
+	project, _ := saveTestProject(t, revisionTestProject,
+		[][]Item{{{Url: "a.jpg"}}}, []testSubmission{
+			{workerId: "alice", submitTime: 9, labels: []Label{
+				{Id: 0, CategoryPath: "car", Data: car},
+			}},
+			{workerId: "alice", submitTime: 10, labels: []Label{
+				{Id: 0, CategoryPath: "truck", Data: truck},
+				{Id: 1, CategoryPath: "person", Data: person,
+					Attributes: map[string]interface{}{"occluded": true}},
+			}},
+			{workerId: "alice", submitTime: 11, labels: []Label{
+				{Id: 1, CategoryPath: "person", Data: person,
+					Attributes: map[string]interface{}{"occluded": false}},
+			}},
+		})
+	return project
+}
+
+func TestRevisions(t *testing.T) {
+	project := saveRevisionTestSubmissions(t)
+	defer deleteTestProject(t, revisionTestProject)
+	revisions, err := ListRevisions(project, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || revisions[2].SubmitTime != 11 ||
+		revisions[1].NumLabels != 2 || revisions[0].WorkerId != "alice" {
+		t.Error("wrong revisions", revisions)
+	}
+	assignment, err := GetAssignment(revisionTestProject, Index2str(0),
+		"alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assignment.SubmitTime != 11 {
+		t.Error("expected the latest submission, got", assignment.SubmitTime)
+	}
+
+	diff, err := DiffRevisions(project, 0, "alice", 9, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].LabelId != 1 ||
+		len(diff.Removed) != 0 || len(diff.Modified) != 1 {
+		t.Fatal("wrong diff", diff)
+	}
+	changes := diff.Modified[0].Changes
+	if len(changes) != 3 || changes[0].Field != "category" ||
+		changes[1].Field != "box2d.x1" || changes[2].Field != "box2d.x2" {
+		t.Error("wrong changes", changes)
+	}
+}
+
+func TestRevisionDiffHandler(t *testing.T) {
+	saveRevisionTestSubmissions(t)
+	defer deleteTestProject(t, revisionTestProject)
+	// the latest revision is compared with the one before it
+	req, err := http.NewRequest("GET", "/revisionDiff?project_name="+
+		revisionTestProject+"&task_index=0&worker=alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	getRevisionDiffHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Revision diff handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	diff := RevisionDiff{}
+	err = json.Unmarshal(rr.Body.Bytes(), &diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.From != 10 || diff.To != 11 || len(diff.Removed) != 1 ||
+		len(diff.Modified) != 1 ||
+		diff.Modified[0].Changes[0].Field != "attributes.occluded" {
+		t.Error("wrong diff", diff)
+	}
+
+	req, err = http.NewRequest("GET", "/revision?project_name="+
+		revisionTestProject+"&task_index=0&worker=alice&submit_time=9", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	getRevisionHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Revision handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	revision := Assignment{}
+	err = json.Unmarshal(rr.Body.Bytes(), &revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.SubmitTime != 9 || len(revision.Labels) != 1 {
+		t.Error("wrong revision", revision)
+	}
+}
+
+func TestRevertRevision(t *testing.T) {
+	project := saveRevisionTestSubmissions(t)
+	defer deleteTestProject(t, revisionTestProject)
+	req, err := http.NewRequest("POST", "/revertRevision",
+		strings.NewReader("project_name="+revisionTestProject+
+			"&task_index=0&worker=alice&submit_time=10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	postRevertRevisionHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Revert handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	revisions, err := ListRevisions(project, 0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the reverted revision is the newest, the history is kept
+	if len(revisions) != 4 || revisions[3].NumLabels != 2 {
+		t.Fatal("wrong revisions after the revert", revisions)
+	}
+	diff, err := DiffRevisions(project, 0, "alice", 10,
+		revisions[3].SubmitTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Modified) != 0 {
+		t.Error("expected the revert to restore the revision, got", diff)
+	}
+	assignment, err := GetAssignment(revisionTestProject, Index2str(0),
+		"alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignment.Labels) != 2 {
+		t.Error("expected the reverted labels, got", assignment.Labels)
+	}
+}
+
+// Saves a v2 task of the default worker with a snapshot and a delta save
+func saveDeltaRevisionTestTask(t *testing.T) (Project, int64, int64) {
+	options := ProjectOptions{Name: revisionTestProject, ItemType: "image",
+		LabelType: "box2dv2"}
+	project := Project{Options: options}
+	err := storage.Save(project.GetKey(), project.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := Task{ProjectOptions: options, Items: []Item{{Url: "a.jpg"}}}
+	err = storage.Save(task.GetKey(), task.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment := Assignment{Task: task, WorkerId: DefaultWorker,
+		StartTime: 1}
+	err = storage.Save(assignment.GetKey(), assignment.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := SatDelta{ProjectName: revisionTestProject, TaskId: Index2str(0),
+		WorkerId: DefaultWorker, BaseRevision: 1, Actions: []DeltaAction{
+			{Type: DeltaUpdateLabel, Label: &LabelData{Id: 3, Type: "tag"}},
+		}}
+	snapshot, err := SaveSatDelta(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta.BaseRevision = snapshot
+	delta.Actions = []DeltaAction{
+		{Type: DeltaUpdateLabel, Label: &LabelData{Id: 4, Type: "tag"}},
+	}
+	deltaTime, err := SaveSatDelta(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return project, snapshot, deltaTime
+}
+
+func TestDeltaRevisions(t *testing.T) {
+	project, snapshot, deltaTime := saveDeltaRevisionTestTask(t)
+	defer deleteTestProject(t, revisionTestProject)
+	if !storage.HasKey(revisionSummaryKey(revisionTestProject, Index2str(0),
+		DefaultWorker, deltaTime)) {
+		t.Error("expected a summary of the delta save")
+	}
+	for _, withSummaries := range []bool{true, false} {
+		if !withSummaries {
+			err := storage.Delete(path.Join(revisionTestProject,
+				"revisionSummaries"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		revisions, err := ListRevisions(project, 0, DefaultWorker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 2 || revisions[0].SubmitTime != snapshot ||
+			revisions[0].NumLabels != 1 || revisions[0].Delta ||
+			revisions[1].SubmitTime != deltaTime ||
+			revisions[1].NumLabels != 2 || !revisions[1].Delta {
+			t.Error("wrong revisions", withSummaries, revisions)
+		}
+	}
+	diff, err := DiffRevisions(project, 0, DefaultWorker, snapshot, deltaTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].LabelId != 4 {
+		t.Error("wrong diff of the delta save", diff)
+	}
+}
+
+func TestRevertDeltaRevision(t *testing.T) {
+	project, snapshot, _ := saveDeltaRevisionTestTask(t)
+	defer deleteTestProject(t, revisionTestProject)
+	revision, err := RevertRevision(project, 0, DefaultWorker, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the latest state is saved as a snapshot before the reverted copy and
+	// the delta save is kept
+	revisions, err := ListRevisions(project, 0, DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 4 || !revisions[1].Delta ||
+		revisions[2].Delta || revisions[2].NumLabels != 2 ||
+		revisions[3].SubmitTime != revision.SubmitTime ||
+		revisions[3].NumLabels != 1 {
+		t.Error("wrong revisions after the revert", revisions)
+	}
+	delta := SatDelta{ProjectName: revisionTestProject, TaskId: Index2str(0),
+		WorkerId: DefaultWorker, BaseRevision: revision.SubmitTime,
+		Actions: []DeltaAction{
+			{Type: DeltaUpdateLabel, Label: &LabelData{Id: 5, Type: "tag"}},
+		}}
+	_, err = SaveSatDelta(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sat, err := GetSat(revisionTestProject, Index2str(0), DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := sat.Task.Items[0].Labels
+	if _, ok := labels[4]; ok || len(labels) != 2 {
+		t.Error("expected the reverted labels with the new one, got", labels)
+	}
+}
+
+// Posts a save of an assignment and returns the status and the response
+func postTestSave(t *testing.T, assignment Assignment) (int, string) {
+	assignmentJson, err := json.Marshal(assignment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "postSave",
+		bytes.NewReader(assignmentJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	postSaveHandler(rr, req)
+	return rr.Code, strings.TrimSpace(rr.Body.String())
+}
+
+func TestSaveRevisionConflict(t *testing.T) {
+	options := ProjectOptions{Name: revisionTestProject, ItemType: "image",
+		LabelType: "box2d"}
+	task := Task{ProjectOptions: options, Items: []Item{{Url: "a.jpg"}}}
+	assignment := Assignment{Task: task, WorkerId: DefaultWorker,
+		StartTime: 5}
+	err := storage.Save(assignment.GetKey(), assignment.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deleteTestProject(t, revisionTestProject)
+	assignment, err = GetAssignment(revisionTestProject, Index2str(0),
+		DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assignment.Revision != 5 {
+		t.Fatal("expected the start time as the first revision, got",
+			assignment.Revision)
+	}
+	code, body := postTestSave(t, assignment)
+	response := SaveResponse{}
+	err = json.Unmarshal([]byte(body), &response)
+	if code != 200 || err != nil || response.Revision <= 5 {
+		t.Fatal("wrong save", code, body)
+	}
+	first := response.Revision
+
+	// another tab saving the same revision is rejected
+	code, body = postTestSave(t, assignment)
+	err = json.Unmarshal([]byte(body), &response)
+	if code != http.StatusConflict || err != nil ||
+		response.Revision != first {
+		t.Error("expected a conflict with the latest revision", code, body)
+	}
+	assignment.Revision = first
+	code, body = postTestSave(t, assignment)
+	if code != 200 {
+		t.Error("wrong save of the latest revision", code, body)
+	}
+
+	// saves without a revision are not checked
+	assignment.Revision = 0
+	code, body = postTestSave(t, assignment)
+	if code != 200 || body != "0" {
+		t.Error("wrong save without a revision", code, body)
+	}
+	if len(listSubmissionKeys(revisionTestProject, Index2str(0),
+		DefaultWorker)) != 3 {
+		t.Error("expected three saves")
+	}
+}
+
+func TestLockTaskSaves(t *testing.T) {
+	unlock := lockTaskSaves(revisionTestProject, Index2str(0), "alice")
+	// saves of another task or worker don't wait for the lock
+	done := make(chan bool)
+	go func() {
+		lockTaskSaves(revisionTestProject, Index2str(1), "alice")()
+		lockTaskSaves(revisionTestProject, Index2str(0), "bob")()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("saves of other tasks wait for the lock")
+	}
+	// saves of the same task wait until it is unlocked
+	go func() {
+		lockTaskSaves(revisionTestProject, Index2str(0), "alice")()
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Fatal("saves of the same task don't wait for the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	<-done
+	saveLocks.Lock()
+	defer saveLocks.Unlock()
+	if len(saveLocks.tasks) != 0 {
+		t.Error("unused locks are kept", saveLocks.tasks)
+	}
+}
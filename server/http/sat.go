@@ -24,6 +24,7 @@ import (
 // Stores the user info
 type User struct {
 	Id           string   `json:"id"`
+	Name         string   `json:"name"`
 	Email        string   `json:"email"`
 	Group        string   `json:"group"`
 	RefreshToken string   `json:"refreshToken"`
@@ -87,6 +88,8 @@ type Assignment struct {
 	NumLabeledItems int                    `json:"numLabeledItems" yaml:"numLabeledItems"`
 	UserAgent       string                 `json:"userAgent" yaml:"userAgent"`
 	IpInfo          map[string]interface{} `json:"ipInfo" yaml:"ipInfo"`
+	// revision the assignment is based on, not saved
+	Revision int64 `json:"revision" yaml:"revision"`
 }
 
 type GatewayInfo struct {
@@ -223,6 +226,7 @@ type Event struct {
 type DashboardContents struct {
 	ProjectMetaData ProjectMetaData `json:"projectMetaData" yaml:"projectMetaData"`
 	TaskMetaDatas   []TaskMetaData  `json:"taskMetaDatas" yaml:"taskMetaDatas"`
+	WorkerScores    []WorkerScores  `json:"workerScores" yaml:"workerScores"`
 }
 
 type TaskUrl struct { //shared type
@@ -251,8 +255,7 @@ func WrapHandler(handler http.Handler) HandleFunc {
 func WrapHandleFunc(fn HandleFunc) HandleFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// check if User Management System is On
-		flag := env.UserManagement == "on" ||
-			env.UserManagement == "On" || env.UserManagement == "ON"
+		flag := isUserManagementOn()
 		refreshTokenCookie, _ := r.Cookie("refreshTokenScalabel")
 		idCookie, _ := r.Cookie("idScalabel")
 		if !flag { // if User Management System is off, continue
@@ -383,7 +386,15 @@ func postProjectHandler(w http.ResponseWriter, r *http.Request) {
 	// parse the attribute list YML from form
 	attributes := getAttributesFromProjectForm(r)
 	// import items and corresponding labels
-	itemLists := getItemsFromProjectForm(r, attributes)
+	itemLists, report := getItemsFromProjectForm(r, categories, attributes)
+	if !report.Empty() && r.FormValue("ignore_unmapped") != "true" {
+		Warning.Println(report.String())
+		_, err = w.Write([]byte(report.String()))
+		if err != nil {
+			Error.Println(err)
+		}
+		return
+	}
 
 	//this field should no longer be used, NumFrames is now stored in Task
 	/*if itemType == "video" {
@@ -484,11 +495,17 @@ func executeLabelingTemplate(w http.ResponseWriter,
 	// get task name from the URL
 	projectName := r.URL.Query()["project_name"][0]
 	taskIndex, _ := strconv.ParseInt(r.URL.Query()["task_index"][0], 10, 32)
+	if !canOpenTask(r, projectName, int(taskIndex)) {
+		http.Error(w, "The task is assigned to another worker",
+			http.StatusForbidden)
+		return
+	}
+	workerId := getWorkerId(r)
 	if !storage.HasKey(path.Join(projectName, "assignments",
-		Index2str(int(taskIndex)), DefaultWorker)) {
+		Index2str(int(taskIndex)), workerId)) {
 		// if assignment does not exist, create it
 		assignment, err := CreateAssignment(projectName,
-			Index2str(int(taskIndex)), DefaultWorker)
+			Index2str(int(taskIndex)), workerId)
 		if err != nil {
 			Error.Println(err)
 			return
@@ -500,7 +517,7 @@ func executeLabelingTemplate(w http.ResponseWriter,
 	} else {
 		// otherwise, get that assignment
 		assignment, err := GetAssignment(projectName,
-			Index2str(int(taskIndex)), DefaultWorker)
+			Index2str(int(taskIndex)), workerId)
 		if err != nil {
 			Error.Println(err)
 			return
@@ -526,19 +543,25 @@ func postLoadAssignmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	projectName := assignmentToLoad.Task.ProjectOptions.Name
 	taskIndex := Index2str(assignmentToLoad.Task.Index)
+	if !canOpenTask(r, projectName, assignmentToLoad.Task.Index) {
+		http.Error(w, "The task is assigned to another worker",
+			http.StatusForbidden)
+		return
+	}
+	workerId := getWorkerId(r)
 	var loadedAssignment Assignment
 	if !storage.HasKey(path.Join(projectName, "assignments",
-		taskIndex, DefaultWorker)) {
+		taskIndex, workerId)) {
 		// if assignment does not exist, create it
 		loadedAssignment, err = CreateAssignment(projectName, taskIndex,
-			DefaultWorker)
+			workerId)
 		if err != nil {
 			Error.Println(err)
 			return
 		}
 	} else {
 		loadedAssignment, err = GetAssignment(projectName, taskIndex,
-			DefaultWorker)
+			workerId)
 		if err != nil {
 			Error.Println(err)
 			return
@@ -570,7 +593,8 @@ func postSaveHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		Error.Println(err)
 	}
-	fields["SubmitTime"] = recordTimestamp()
+	// workers can only save their own assignments
+	fields["WorkerId"] = getWorkerId(r)
 	assignment := Assignment{}
 	err = mapstructure.Decode(fields, &assignment)
 	if err != nil {
@@ -581,12 +605,36 @@ func postSaveHandler(w http.ResponseWriter, r *http.Request) {
 		writeNil(w)
 		return
 	}
+	unlock := lockTaskSaves(assignment.Task.ProjectOptions.Name,
+		Index2str(assignment.Task.Index), assignment.WorkerId)
+	// saves based on an older revision are rejected
+	assignment.SubmitTime, err = checkRevision(
+		assignment.Task.ProjectOptions.Name, Index2str(assignment.Task.Index),
+		assignment.WorkerId, assignment.Revision)
 	// TODO: don't send all events to front end,
 	// and append these events to most recent
-	err = storage.Save(assignment.GetKey(), assignment.GetFields())
+	if err == nil {
+		err = storage.Save(assignment.GetKey(), assignment.GetFields())
+	}
+	if err == nil {
+		saveRevisionSummary(assignment.Task.ProjectOptions.Name,
+			Index2str(assignment.Task.Index), assignmentRevision(assignment))
+	}
+	unlock()
+	if writeRevisionConflict(w, err) {
+		return
+	}
+	if err == nil && assignment.Task.ProjectOptions.Submitted {
+		recordSubmission(assignment.Task.ProjectOptions.Name,
+			Index2str(assignment.Task.Index), assignment.WorkerId,
+			assignment.SubmitTime, exportTaskItems)
+	}
 	if err != nil {
 		Error.Println(err)
 		writeNil(w)
+	} else if assignment.Revision != 0 {
+		// saves based on a revision get the new revision
+		writeRevisionResponse(w, SaveResponse{assignment.SubmitTime})
 	} else {
 		response, err := json.Marshal(0)
 		if err != nil {
@@ -614,6 +662,14 @@ func postExportHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		Error.Println(err)
 	}
+	exporter, ok := getRequestExporter(w, r, projectToLoad)
+	if !ok {
+		return
+	}
+	filter, ok := getRequestExportFilter(w, r)
+	if !ok {
+		return
+	}
 
 	// Grab the latest submissions from all tasks
 	tasks, err := GetTasksInProject(projectName)
@@ -621,92 +677,129 @@ func postExportHandler(w http.ResponseWriter, r *http.Request) {
 		Error.Println(err)
 		return
 	}
+	writeExport(w, r, exporter, projectToLoad,
+		exportTaskStream(projectToLoad, tasks, filter, exportTaskItems))
+}
+
+// Converts the latest submission of a task into exported items
+func exportTaskItems(projectToLoad Project, task Task,
+	filter ExportFilter) []ItemExport {
 	items := []ItemExport{}
-	var latestSubmission Assignment
-	for _, task := range tasks {
-		latestSubmission, err = GetAssignment(projectName,
-			Index2str(task.Index), DefaultWorker)
-		if err == nil {
-			for _, itemToLoad := range latestSubmission.Task.Items {
-				item := ItemExport{}
-				item.Index = itemToLoad.Index
-				if projectToLoad.Options.ItemType == "video" {
-					item.VideoName = itemToLoad.VideoName
-				} else {
-					//TODO: ask about what to do here
-					item.VideoName = itemToLoad.VideoName
-					//item.VideoName = projectToLoad.Options.Name
-					//+ "_" + Index2str(task.Index)
-				}
-				item.Timestamp = itemToLoad.Timestamp
-				item.Name = itemToLoad.Url
-				item.Url = itemToLoad.Url
-				for _, labelId := range itemToLoad.LabelIds {
-					var labelToLoad Label
-					for _, label := range latestSubmission.Labels {
-						if label.Id == labelId {
-							labelToLoad = label
-							break
-						}
-					}
-					label := LabelExport{}
-					label.Category = labelToLoad.CategoryPath
-					label.Attributes = labelToLoad.Attributes
-					switch projectToLoad.Options.LabelType {
-					case "box2d":
-						label.Box2d = ParseBox2d(labelToLoad.Data)
-					case "box3d":
-						label.Box3d = ParseBox3d(labelToLoad.Data)
-					case "segmentation":
-						label.Poly2d = ParsePoly2d(labelToLoad.Data)
-					case "lane":
-						label.Poly2d = ParsePoly2d(labelToLoad.Data)
-					}
-					label.ManualShape = true
-					if projectToLoad.Options.ItemType == "video" {
-						label.ManualShape = labelToLoad.Keyframe
-						label.Id = labelToLoad.ParentId
-					} else {
-						label.ManualShape = true
-						label.Id = labelId
-					}
-					item.Labels = append(item.Labels, label)
-				}
-				items = append(items, item)
+	taskIndex := Index2str(task.Index)
+	workerId := filter.taskWorker(projectToLoad.Options.Name, taskIndex)
+	if !filter.IncludeUnlabeled &&
+		!hasSubmission(projectToLoad.Options.Name, taskIndex, workerId) {
+		return items
+	}
+	latestSubmission, err := GetAssignment(projectToLoad.Options.Name,
+		taskIndex, workerId)
+	if filter.SubmittedOnly &&
+		(err != nil || !latestSubmission.Task.ProjectOptions.Submitted) {
+		return items
+	}
+	if filter.AcceptedOnly && (err != nil ||
+		!isSubmissionAccepted(projectToLoad.Options.Name, task.Index,
+			workerId, latestSubmission.SubmitTime)) {
+		return items
+	}
+	if err == nil {
+		items = assignmentItemExports(projectToLoad, latestSubmission)
+	} else {
+		// if file not found, return list of items with url
+		Info.Println(err)
+		for _, itemToLoad := range task.Items {
+			item := ItemExport{}
+			item.Index = itemToLoad.Index
+			if projectToLoad.Options.ItemType == "video" {
+				item.VideoName = itemToLoad.VideoName
+			} else {
+				//TODO: ask about what to do here
+				item.VideoName = itemToLoad.VideoName
 			}
+			item.Timestamp = itemToLoad.Timestamp
+			item.Name = itemToLoad.Url
+			item.Url = itemToLoad.Url
+			item.Labels = itemToLoad.LabelImport
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Converts the items of an assignment into exported items
+func assignmentItemExports(projectToLoad Project,
+	assignment Assignment) []ItemExport {
+	items := []ItemExport{}
+	for _, itemToLoad := range assignment.Task.Items {
+		item := ItemExport{}
+		item.Index = itemToLoad.Index
+		if projectToLoad.Options.ItemType == "video" {
+			item.VideoName = itemToLoad.VideoName
 		} else {
-			// if file not found, return list of items with url
-			Info.Println(err)
-			for _, itemToLoad := range task.Items {
-				item := ItemExport{}
-				item.Index = itemToLoad.Index
-				if projectToLoad.Options.ItemType == "video" {
-					item.VideoName = itemToLoad.VideoName
-				} else {
-					//TODO: ask about what to do here
-					item.VideoName = itemToLoad.VideoName
+			//TODO: ask about what to do here
+			item.VideoName = itemToLoad.VideoName
+			//item.VideoName = projectToLoad.Options.Name
+			//+ "_" + Index2str(task.Index)
+		}
+		item.Timestamp = itemToLoad.Timestamp
+		item.Name = itemToLoad.Url
+		item.Url = itemToLoad.Url
+		for _, labelId := range itemToLoad.LabelIds {
+			var labelToLoad Label
+			for _, label := range assignment.Labels {
+				if label.Id == labelId {
+					labelToLoad = label
+					break
 				}
-				item.Timestamp = itemToLoad.Timestamp
-				item.Name = itemToLoad.Url
-				item.Url = itemToLoad.Url
-				item.Labels = itemToLoad.LabelImport
-				items = append(items, item)
 			}
+			label := LabelExport{}
+			label.Category = labelToLoad.CategoryPath
+			label.Attributes = labelToLoad.Attributes
+			switch projectToLoad.Options.LabelType {
+			case "box2d":
+				label.Box2d = ParseBox2d(labelToLoad.Data)
+			case "box3d":
+				label.Box3d = ParseBox3d(labelToLoad.Data)
+			case "segmentation":
+				label.Poly2d = ParsePoly2d(labelToLoad.Data)
+			case "lane":
+				label.Poly2d = ParsePoly2d(labelToLoad.Data)
+			}
+			label.ManualShape = true
+			// labels of tracks are identified by their track
+			if projectToLoad.Options.ItemType == "video" ||
+				projectToLoad.Options.ItemType == "pointcloudtracking" {
+				label.ManualShape = labelToLoad.Keyframe
+				label.Id = labelToLoad.ParentId
+			} else {
+				label.ManualShape = true
+				label.Id = labelId
+			}
+			item.Labels = append(item.Labels, label)
 		}
+		items = append(items, item)
 	}
+	return items
+}
 
-	exportJson, err := json.MarshalIndent(items, "", "  ")
-	if err != nil {
-		Error.Println(err)
-	}
-
-	//set relevant header.
-	w.Header().Set("Content-Disposition",
-		fmt.Sprintf("attachment; filename=%s_results.json", projectName))
-	_, err = io.Copy(w, bytes.NewReader(exportJson))
+// Gets the url of the labeling page of a task on the requested host
+func getTaskUrl(r *http.Request, projectName string, task Task) (string,
+	error) {
+	u, err := url.Parse(task.ProjectOptions.HandlerUrl)
 	if err != nil {
-		Error.Println(err)
+		return "", err
+	}
+	q := u.Query()
+	q.Set("project_name", projectName)
+	q.Set("task_index", Index2str(task.Index))
+	u.RawQuery = q.Encode()
+	if r.TLS != nil {
+		u.Scheme = "https"
+	} else {
+		u.Scheme = "http"
 	}
+	u.Host = r.Host
+	return u.String(), nil
 }
 
 // Handles the download of submitted assignments
@@ -718,25 +811,13 @@ func downloadTaskUrlHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var u *url.URL
 	taskUrls := []TaskUrl{}
 	for _, task := range tasks {
 		taskUrl := TaskUrl{}
-		u, err = url.Parse(task.ProjectOptions.HandlerUrl)
+		taskUrl.Url, err = getTaskUrl(r, projectName, task)
 		if err != nil {
 			log.Fatal(err)
 		}
-		q := u.Query()
-		q.Set("project_name", projectName)
-		q.Set("task_index", Index2str(task.Index))
-		u.RawQuery = q.Encode()
-		if r.TLS != nil {
-			u.Scheme = "https"
-		} else {
-			u.Scheme = "http"
-		}
-		u.Host = r.Host
-		taskUrl.Url = u.String()
 		taskUrls = append(taskUrls, taskUrl)
 	}
 
@@ -835,9 +916,8 @@ func getAttributesFromProjectForm(r *http.Request) []Attribute {
 }
 
 // helper function for loading label json file to seperate indices by videoname
-func handleAttributeLoad(itemPtr *Item, itemImport ItemExport,
-	attributes []Attribute) {
-	item := *itemPtr
+func handleAttributeLoad(item *Item, itemImport ItemExport,
+	attributes []Attribute, report *ImportReport) {
 	item.Attributes = map[string][]int{}
 	keys := reflect.ValueOf(itemImport.Attributes).MapKeys()
 	strkeys := make([]string, len(keys))
@@ -845,25 +925,65 @@ func handleAttributeLoad(itemPtr *Item, itemImport ItemExport,
 		strkeys[i] = keys[i].String()
 	}
 	for _, key := range strkeys {
+		found := false
 		for _, attribute := range attributes {
 			if attribute.Name == key {
+				found = true
 				for i := 0; i < len(attribute.Values); i++ {
 					if itemImport.Attributes[key] == attribute.Values[i] {
 						item.Attributes[key] = []int{i}
 						break
 					}
 				}
+				if _, ok := item.Attributes[key]; !ok {
+					report.Add("unknown value %q of item attribute %q",
+						itemImport.Attributes[key], key)
+				}
 				break
 			}
 		}
+		if !found {
+			report.Add("unknown item attribute %q", key)
+		}
 	}
 }
 
-// load label json file
-func getItemsFromProjectForm(r *http.Request,
-	attributes []Attribute) map[string][]Item {
-	itemLists := make(map[string][]Item) //map[string][]Item
+// Parses the uploaded item file according to its format, which is either
+// given by the import_format form field or detected from the file
+func parseItemImport(r *http.Request, fileName string, contents []byte,
+	categories []Category, attributes []Attribute,
+	report *ImportReport) ([]ItemExport, error) {
 	var itemsImport []ItemExport
+	format := r.FormValue("import_format")
+	if format == "" {
+		format = detectImportFormat(fileName, contents)
+	}
+	urlPrefix := r.FormValue("url_prefix")
+	switch format {
+	case "coco":
+		return importCocoItems(contents, urlPrefix, categories, attributes,
+			report)
+	case "voc":
+		return importVocItems(fileName, contents, urlPrefix, categories,
+			attributes, report)
+	case "scalabel":
+		var err error
+		if strings.HasSuffix(fileName, ".json") {
+			err = json.Unmarshal(contents, &itemsImport)
+		} else {
+			err = yaml.Unmarshal(contents, &itemsImport)
+		}
+		return itemsImport, err
+	}
+	return itemsImport, fmt.Errorf("Unknown import format %s", format)
+}
+
+// load label json file, entries that cannot be mapped onto the
+// categories and attributes of the project are collected in the report
+func getItemsFromProjectForm(r *http.Request, categories []Category,
+	attributes []Attribute) (map[string][]Item, *ImportReport) {
+	itemLists := make(map[string][]Item) //map[string][]Item
+	report := &ImportReport{}
 	importFile, header, err := r.FormFile("item_file")
 
 	switch err {
@@ -875,13 +995,11 @@ func getItemsFromProjectForm(r *http.Request,
 		if err != nil {
 			Error.Println(err)
 		}
-		if strings.HasSuffix(header.Filename, ".json") {
-			err = json.Unmarshal(importFileBuf.Bytes(), &itemsImport)
-		} else {
-			err = yaml.Unmarshal(importFileBuf.Bytes(), &itemsImport)
-		}
+		itemsImport, err := parseItemImport(r, header.Filename,
+			importFileBuf.Bytes(), categories, attributes, report)
 		if err != nil {
 			Error.Println(err)
+			report.Add("invalid item file: %v", err)
 		}
 
 		//to seperate indexes by videoName. This also initializes indexes to 0.
@@ -894,11 +1012,15 @@ func getItemsFromProjectForm(r *http.Request,
 			item.Timestamp = itemImport.Timestamp
 			// load item attributes if needed
 			if len(itemImport.Attributes) > 0 {
-				handleAttributeLoad(&item, itemImport, attributes)
+				handleAttributeLoad(&item, itemImport, attributes, report)
 			}
 			if len(itemImport.Labels) > 0 {
 				item.LabelImport = itemImport.Labels
 			}
+			for _, label := range itemImport.GroundTruth {
+				item.GroundTruth = append(item.GroundTruth,
+					labelExportToGroundTruth(label))
+			}
 			if itemImport.VideoName == "" {
 				itemLists[" "] = append(itemLists[" "], item)
 			} else {
@@ -914,7 +1036,7 @@ func getItemsFromProjectForm(r *http.Request,
 	default:
 		Error.Println(err)
 	}
-	return itemLists
+	return itemLists, report
 }
 
 func CreateTasks(project Project) {
@@ -1136,6 +1258,8 @@ func authHandler(w http.ResponseWriter, r *http.Request) {
 	// load the projects information from disk for this user
 	if _, ok := Users[userInfo.Id]; ok {
 		userInfo.Projects = Users[userInfo.Id].Projects
+	} else {
+		userInfo.Projects = getUserProjects(userInfo.Id)
 	}
 	Users[userInfo.Id] = &userInfo // save userinfo to memory
 
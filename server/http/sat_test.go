@@ -52,6 +52,68 @@ func addFileToForm(writer *multipart.Writer,
 	return nil
 }
 
+// Labels submitted by a worker on the first task of a test project
+type testSubmission struct {
+	workerId   string
+	submitTime int64
+	labels     []Label
+	submitted  bool
+}
+
+// Saves a test project labeling image boxes with a task for each list of
+// items. The workers of the submissions get an assignment of the first task
+// and submit their labels on its first item, unless the submit time is 0.
+func saveTestProject(t *testing.T, projectName string, taskItems [][]Item,
+	submissions []testSubmission) (Project, []Task) {
+	options := ProjectOptions{Name: projectName, ItemType: "image",
+		LabelType: "box2d", HandlerUrl: "label2d"}
+	project := Project{Options: options}
+	saveTestKey(t, project.GetKey(), project.GetFields())
+	tasks := []Task{}
+	for i, items := range taskItems {
+		task := Task{ProjectOptions: options, Index: i, Items: items}
+		saveTestKey(t, task.GetKey(), task.GetFields())
+		tasks = append(tasks, task)
+	}
+	for _, submission := range submissions {
+		assignment := Assignment{Task: tasks[0],
+			WorkerId: submission.workerId}
+		saveTestKey(t, assignment.GetKey(), assignment.GetFields())
+		if submission.submitTime == 0 {
+			continue
+		}
+		assignment.SubmitTime = submission.submitTime
+		assignment.Labels = submission.labels
+		assignment.Task.ProjectOptions.Submitted = submission.submitted
+		assignment.Task.Items = append([]Item{}, tasks[0].Items...)
+		assignment.Task.Items[0].LabelIds = []int{}
+		for _, label := range submission.labels {
+			assignment.Task.Items[0].LabelIds = append(
+				assignment.Task.Items[0].LabelIds, label.Id)
+		}
+		if len(submission.labels) > 0 {
+			assignment.NumLabeledItems = 1
+		}
+		saveTestKey(t, assignment.GetKey(), assignment.GetFields())
+	}
+	return project, tasks
+}
+
+func saveTestKey(t *testing.T, key string, fields map[string]interface{}) {
+	err := storage.Save(key, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Deletes all the keys of a test project, to be deferred by the tests
+func deleteTestProject(t *testing.T, projectName string) {
+	err := storage.Delete(projectName)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 func TestMain(m *testing.M) {
 	_, err := session.NewSession()
 	if err == nil {
@@ -70,12 +132,24 @@ func TestMain(m *testing.M) {
 			m.Run()
 		}
 	}
-	storage = &FileStorage{}
-	err = storage.Init(env.DataDir)
-	if err != nil {
-		log.Fatal(err)
+	// every storage is tested, the first failure is the exit code
+	exitCode := 0
+	runWithStorage := func(s Storage) {
+		storage = s
+		err := storage.Init(env.DataDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if code := m.Run(); code != 0 && exitCode == 0 {
+			exitCode = code
+		}
 	}
-	os.Exit(m.Run())
+	runWithStorage(&InMemoryStorage{})
+	// a small cache evicts keys during the tests
+	runWithStorage(NewCachedStorage(&InMemoryStorage{}, CacheConfig{Size: 16}))
+	runWithStorage(&SqlStorage{Driver: "sqlite3"})
+	runWithStorage(&FileStorage{})
+	os.Exit(exitCode)
 }
 
 func TestPostProject(t *testing.T) {
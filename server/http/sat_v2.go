@@ -1,12 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"html/template"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"path"
@@ -20,6 +17,10 @@ type Sat struct {
 	Task    TaskData    `json:"task" yaml:"task"`
 	User    UserData    `json:"user" yaml:"user"`
 	Session SessionData `json:"session" yaml:"session"`
+	// revision the sat is based on, not saved
+	Revision int64 `json:"revision" yaml:"revision"`
+	// the save is a submission of the task, not saved
+	Submit bool `json:"submit" yaml:"submit"`
 }
 
 //Task specific data
@@ -139,6 +140,10 @@ type SessionData struct {
 	DemoMode     bool         `json:"demoMode" yaml:"demoMode"`
 	StartTime    int64        `json:"startTime" yaml:"startTime"`
 	ItemStatuses []ItemStatus `json:"items" yaml:"items"`
+	// the task is locked by another session and may only be viewed
+	ReadOnly bool `json:"readOnly" yaml:"readOnly"`
+	// user holding the lock of the task of a read-only session
+	LockHolder string `json:"lockHolder" yaml:"lockHolder"`
 }
 
 //Item status
@@ -166,9 +171,7 @@ func (sat *Sat) GetFields() map[string]interface{} {
 func GetSat(projectName string, taskIndex string,
 	workerId string) (Sat, error) {
 	sat := Sat{}
-	submissionsPath := path.Join(projectName, "submissions",
-		taskIndex, workerId)
-	keys := storage.ListKeys(submissionsPath)
+	keys := listSubmissionKeys(projectName, taskIndex, workerId)
 	// if any submissions exist, get the most recent one
 	if len(keys) > 0 {
 		Info.Printf("Reading %s\n", keys[len(keys)-1])
@@ -197,6 +200,14 @@ func GetSat(projectName string, taskIndex string,
 			return Sat{}, err
 		}
 		sat = assignmentToSat(&assignment)
+		sat.Revision = assignment.StartTime
+	}
+	err := applyPendingDeltas(&sat, projectName, taskIndex, workerId)
+	if err != nil {
+		return Sat{}, err
+	}
+	if len(keys) > 0 {
+		sat.Revision = sat.Task.Config.SubmitTime
 	}
 	return sat, nil
 }
@@ -231,27 +242,44 @@ func postLoadAssignmentV2Handler(w http.ResponseWriter, r *http.Request) {
 	}
 	projectName := assignmentToLoad.Task.ProjectOptions.Name
 	taskIndex := Index2str(assignmentToLoad.Task.Index)
+	if !canOpenTask(r, projectName, assignmentToLoad.Task.Index) {
+		http.Error(w, "The task is assigned to another worker",
+			http.StatusForbidden)
+		return
+	}
+	workerId := getWorkerId(r)
 	var loadedAssignment Assignment
 	var loadedSat Sat
 	if !storage.HasKey(path.Join(projectName, "assignments",
-		taskIndex, DefaultWorker)) {
+		taskIndex, workerId)) {
 		// if assignment does not exist, create it
 		loadedAssignment, err = CreateAssignment(projectName, taskIndex,
-			DefaultWorker)
+			workerId)
 		if err != nil {
 			Error.Println(err)
 			return
 		}
 		loadedSat = assignmentToSat(&loadedAssignment)
+		loadedSat.Revision = loadedAssignment.StartTime
 	} else {
 		loadedSat, err = GetSat(projectName, taskIndex,
-			DefaultWorker)
+			workerId)
 		if err != nil {
 			Error.Println(err)
 			return
 		}
 	}
 	loadedSat.Session.StartTime = recordTimestamp()
+	// every load is a new labeling session, only one of them holds the lock
+	loadedSat.Session.SessionId = getUuidV4()
+	lock, acquired, err := AcquireTaskLock(projectName,
+		assignmentToLoad.Task.Index, workerId, loadedSat.Session.SessionId)
+	if err != nil {
+		Error.Println(err)
+	} else if !acquired {
+		loadedSat.Session.ReadOnly = true
+		loadedSat.Session.LockHolder = userName(lock.WorkerId)
+	}
 	loadedSatJson, err := json.Marshal(loadedSat)
 	if err != nil {
 		Error.Println(err)
@@ -267,11 +295,22 @@ func executeLabelingTemplateV2(w http.ResponseWriter, r *http.Request,
 	// get task name from the URL
 	projectName := r.URL.Query()["project_name"][0]
 	taskIndex, _ := strconv.ParseInt(r.URL.Query()["task_index"][0], 10, 32)
+	if !canOpenTask(r, projectName, int(taskIndex)) {
+		http.Error(w, "The task is assigned to another worker",
+			http.StatusForbidden)
+		return
+	}
+	workerId := getWorkerId(r)
+	// the task is locked for the worker until its labeling session loads
+	_, _, err := AcquireTaskLock(projectName, int(taskIndex), workerId, "")
+	if err != nil {
+		Error.Println(err)
+	}
 	if !storage.HasKey(path.Join(projectName, "assignments",
-		Index2str(int(taskIndex)), DefaultWorker)) {
+		Index2str(int(taskIndex)), workerId)) {
 		// if assignment does not exist, create it
 		assignment, err := CreateAssignment(projectName,
-			Index2str(int(taskIndex)), DefaultWorker)
+			Index2str(int(taskIndex)), workerId)
 		if err != nil {
 			Error.Println(err)
 			return
@@ -283,7 +322,7 @@ func executeLabelingTemplateV2(w http.ResponseWriter, r *http.Request,
 	} else {
 		// otherwise, get that assignment
 		assignment, err := GetAssignmentV2(projectName,
-			Index2str(int(taskIndex)), DefaultWorker)
+			Index2str(int(taskIndex)), workerId)
 		if err != nil {
 			Error.Println(err)
 			return
@@ -443,11 +482,50 @@ func postSaveV2Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	assignment.Task.Config.SubmitTime = recordTimestamp()
-	err = storage.Save(assignment.GetKey(), assignment.GetFields())
+	// workers can only save their own sats
+	assignment.User.UserId = getWorkerId(r)
+	taskIndex, err := strconv.Atoi(assignment.Task.Config.TaskId)
+	if err == nil {
+		err = checkTaskLock(assignment.Task.Config.ProjectName, taskIndex,
+			assignment.User.UserId, assignment.Session.SessionId)
+		if writeTaskLocked(w, err) {
+			return
+		}
+		if err != nil {
+			Error.Println(err)
+			writeNil(w)
+			return
+		}
+	}
+	unlock := lockTaskSaves(assignment.Task.Config.ProjectName,
+		assignment.Task.Config.TaskId, assignment.User.UserId)
+	// saves based on an older revision are rejected
+	assignment.Task.Config.SubmitTime, err = checkRevision(
+		assignment.Task.Config.ProjectName, assignment.Task.Config.TaskId,
+		assignment.User.UserId, assignment.Revision)
+	if err == nil {
+		err = storage.Save(assignment.GetKey(), assignment.GetFields())
+	}
+	if err == nil {
+		saveRevisionSummary(assignment.Task.Config.ProjectName,
+			assignment.Task.Config.TaskId, satRevision(assignment))
+	}
+	unlock()
+	if writeRevisionConflict(w, err) {
+		return
+	}
+	if err == nil && assignment.Submit {
+		recordSubmission(assignment.Task.Config.ProjectName,
+			assignment.Task.Config.TaskId, assignment.User.UserId,
+			assignment.Task.Config.SubmitTime, exportTaskItemsV2AsV1)
+	}
 	if err != nil {
 		Error.Println(err)
 		writeNil(w)
+	} else if assignment.Revision != 0 {
+		// saves based on a revision get the new revision
+		writeRevisionResponse(w,
+			SaveResponse{assignment.Task.Config.SubmitTime})
 	} else {
 		response, err := json.Marshal(0)
 		if err != nil {
@@ -475,55 +553,93 @@ func postExportV2Handler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		Error.Println(err)
 	}
+	exporter, ok := getRequestExporter(w, r, projectToLoad)
+	if !ok {
+		return
+	}
+	filter, ok := getRequestExportFilter(w, r)
+	if !ok {
+		return
+	}
 	// Grab the latest submissions from all tasks
 	tasks, err := GetTasksInProject(projectName)
 	if err != nil {
 		Error.Println(err)
 		return
 	}
+	writeExport(w, r, exporter, projectToLoad,
+		exportTaskStream(projectToLoad, tasks, filter, exportTaskItemsV2AsV1))
+}
+
+// Converts the latest sat of a task into exported items in the v1 format
+func exportTaskItemsV2AsV1(projectToLoad Project, task Task,
+	filter ExportFilter) []ItemExport {
+	items := []ItemExport{}
+	for _, item := range exportTaskItemsV2(projectToLoad, task, filter) {
+		items = append(items, item.ToItemExport())
+	}
+	return items
+}
+
+// Converts the latest sat of a task into exported v2 items. Every saved
+// sat counts as a submission since v2 tasks have no submit state.
+func exportTaskItemsV2(projectToLoad Project, task Task,
+	filter ExportFilter) []ItemExportV2 {
 	items := []ItemExportV2{}
-	sat := Sat{}
-	for _, task := range tasks {
-		sat, err = GetSat(projectName, Index2str(task.Index), DefaultWorker)
-		if err == nil {
-			for _, itemToLoad := range sat.Task.Items {
-				item := exportItemData(
-					itemToLoad,
-					sat.Task.Config,
-					task.Index,
-					projectToLoad.Options.ItemType,
-					projectToLoad.Options.Name)
-				items = append(items, item)
-			}
-		} else {
-			// if file not found, return list of items with url
-			Info.Println(err)
-			for _, itemToLoad := range task.Items {
-				item := ItemExportV2{}
-				item.Index = itemToLoad.Index
-				if projectToLoad.Options.ItemType == "video" {
-					item.VideoName = projectToLoad.Options.Name +
-						"_" + Index2str(task.Index)
-				}
-				item.Timestamp = 10000 // to be fixed
-				item.Name = itemToLoad.Url
-				item.Url = itemToLoad.Url
-				items = append(items, item)
+	taskIndex := Index2str(task.Index)
+	workerId := filter.taskWorker(projectToLoad.Options.Name, taskIndex)
+	if (filter.SubmittedOnly || filter.AcceptedOnly ||
+		!filter.IncludeUnlabeled) &&
+		!hasSubmission(projectToLoad.Options.Name, taskIndex, workerId) {
+		return items
+	}
+	sat, err := GetSat(projectToLoad.Options.Name, taskIndex, workerId)
+	if filter.AcceptedOnly && (err != nil ||
+		!isSubmissionAccepted(projectToLoad.Options.Name, task.Index,
+			workerId, sat.Task.Config.SubmitTime)) {
+		return items
+	}
+	if err == nil {
+		items = satItemExports(projectToLoad, sat, task)
+	} else {
+		// if file not found, return list of items with url
+		Info.Println(err)
+		for _, itemToLoad := range task.Items {
+			item := ItemExportV2{}
+			item.Index = itemToLoad.Index
+			if projectToLoad.Options.ItemType == "video" ||
+				projectToLoad.Options.ItemType == "pointcloudtracking" {
+				item.VideoName = projectToLoad.Options.Name +
+					"_" + Index2str(task.Index)
 			}
+			item.Timestamp = itemToLoad.Timestamp
+			item.Name = itemToLoad.Url
+			item.Url = itemToLoad.Url
+			items = append(items, item)
 		}
 	}
+	return items
+}
 
-	exportJson, err := json.MarshalIndent(items, "", "  ")
-	if err != nil {
-		Error.Println(err)
-	}
-
-	//set relevant header.
-	w.Header().Set("Content-Disposition",
-		fmt.Sprintf("attachment; filename=%s_results.json", projectName))
-	_, err = io.Copy(w, bytes.NewReader(exportJson))
-	if err != nil {
-		Error.Println(err)
+// Converts the items of a sat into exported v2 items. The timestamps are
+// the timestamps of the items of the task, as for unlabeled items.
+func satItemExports(projectToLoad Project, sat Sat,
+	task Task) []ItemExportV2 {
+	items := []ItemExportV2{}
+	for _, itemToLoad := range sat.Task.Items {
+		item := exportItemData(
+			itemToLoad,
+			sat.Task.Config,
+			task.Index,
+			projectToLoad.Options.ItemType,
+			projectToLoad.Options.Name)
+		for _, taskItem := range task.Items {
+			if taskItem.Index == item.Index {
+				item.Timestamp = taskItem.Timestamp
+				break
+			}
+		}
+		items = append(items, item)
 	}
-
+	return items
 }
@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -88,3 +90,78 @@ func TestSavePostRealInputV2(t *testing.T) {
 		t.Fatal(fmt.Errorf(errString, rr.Body.String()))
 	}
 }
+
+// Posts a v2 save and returns the status and the revision of the response
+func postTestSaveV2(t *testing.T, sat Sat) (int, int64) {
+	satJson, err := json.Marshal(sat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "postSaveV2",
+		bytes.NewReader(satJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	postSaveV2Handler(rr, req)
+	response := SaveResponse{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err, rr.Body.String())
+	}
+	return rr.Code, response.Revision
+}
+
+// Tests that the revision of a loaded sat protects its saves
+func TestSaveRevisionRoundTripV2(t *testing.T) {
+	projectName := "scalabel_revision_v2_test"
+	options := ProjectOptions{Name: projectName, ItemType: "image",
+		LabelType: "box2dv2"}
+	task := Task{ProjectOptions: options, Items: []Item{{Url: "a.jpg"}}}
+	err := storage.Save(task.GetKey(), task.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deleteTestProject(t, projectName)
+	load := func() Sat {
+		req, err := http.NewRequest("POST", "postLoadAssignmentV2",
+			strings.NewReader(`{"task": {"index": 0, "projectOptions": `+
+				`{"name": "`+projectName+`"}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		postLoadAssignmentV2Handler(rr, req)
+		sat := Sat{}
+		err = json.Unmarshal(rr.Body.Bytes(), &sat)
+		if err != nil {
+			t.Fatal(err, rr.Body.String())
+		}
+		return sat
+	}
+	sat := load()
+	if sat.Revision == 0 {
+		t.Fatal("expected the revision of the new assignment")
+	}
+	stale := sat.Revision
+	code, revision := postTestSaveV2(t, sat)
+	if code != 200 || revision <= stale {
+		t.Fatal("expected a new revision, got", code, revision)
+	}
+	// another save based on the loaded revision conflicts
+	code, latest := postTestSaveV2(t, sat)
+	if code != http.StatusConflict || latest != revision {
+		t.Error("expected a conflict with the latest revision, got", code,
+			latest)
+	}
+	sat.Revision = revision
+	code, revision = postTestSaveV2(t, sat)
+	if code != 200 || revision <= latest {
+		t.Error("expected a save based on the new revision, got", code,
+			revision)
+	}
+	if reloaded := load(); reloaded.Revision != revision {
+		t.Error("expected the latest revision on reload, got",
+			reloaded.Revision)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Tables of the SQL storages. Keys are compared byte by byte, so that the
+// primary key index serves the prefix queries.
+var sqlTables = map[string]string{
+	"sqlite3": `CREATE TABLE IF NOT EXISTS scalabel (
+		key TEXT PRIMARY KEY,
+		fields TEXT NOT NULL)`,
+	"postgres": `CREATE TABLE IF NOT EXISTS scalabel (
+		key TEXT COLLATE "C" PRIMARY KEY,
+		fields JSONB NOT NULL)`,
+}
+
+//implement Storage interface
+type SqlStorage struct {
+	// driver of the database, sqlite3 or postgres
+	Driver string
+	db     *sql.DB
+}
+
+// Opens the database. The path is the data directory of the sqlite database
+// file or the connection string of the postgres database.
+func (ss *SqlStorage) Init(path string) error {
+	source := path
+	if ss.Driver == "sqlite3" {
+		err := os.MkdirAll(path, 0777)
+		if err != nil {
+			return err
+		}
+		source = sqliteSource(path)
+	}
+	db, err := sql.Open(ss.Driver, source)
+	if err != nil {
+		return err
+	}
+	if ss.Driver == "sqlite3" {
+		// sqlite allows a single writer
+		db.SetMaxOpenConns(1)
+	}
+	ss.db = db
+	_, err = ss.db.Exec(sqlTables[ss.Driver])
+	return err
+}
+
+// Gets the sqlite database file in a data directory
+func sqliteSource(dataDir string) string {
+	return path.Join(dataDir, "scalabel.db")
+}
+
+// Range of the keys under a prefix, the character after '/' is '0'
+func keyRange(prefix string) (string, string) {
+	return prefix + "/", prefix + "0"
+}
+
+func (ss *SqlStorage) HasKey(key string) bool {
+	var found int
+	err := ss.db.QueryRow("SELECT 1 FROM scalabel WHERE key = $1",
+		key).Scan(&found)
+	return err == nil
+}
+
+// Lists the keys and the directories of keys directly under prefix, like
+// the files of a directory in the file storage. The keys under a directory
+// are skipped with a single index lookup, so that the keys deeper under the
+// prefix are not read.
+func (ss *SqlStorage) ListKeys(prefix string) []string {
+	keys := []string{}
+	start, end := "", ""
+	if prefix != "" {
+		start, end = keyRange(prefix)
+	}
+	from, inclusive := start, true
+	for {
+		key, err := ss.nextKey(from, inclusive, end)
+		if err != nil {
+			Error.Println(err)
+			break
+		}
+		if key == "" {
+			break
+		}
+		keys = append(keys, key)
+		child := childKeys(prefix, []string{key})[0]
+		if key == child {
+			from, inclusive = key, false
+		} else {
+			// the character after '/' is '0'
+			from, inclusive = child+"0", true
+		}
+	}
+	return childKeys(prefix, keys)
+}
+
+// Gets the first key from a key and before an end key, or "" if there is
+// none. The range has no end if the end key is empty.
+func (ss *SqlStorage) nextKey(from string, inclusive bool,
+	end string) (string, error) {
+	query := "SELECT key FROM scalabel WHERE key > $1"
+	if inclusive {
+		query = "SELECT key FROM scalabel WHERE key >= $1"
+	}
+	args := []interface{}{from}
+	if end != "" {
+		query += " AND key < $2"
+		args = append(args, end)
+	}
+	var key string
+	err := ss.db.QueryRow(query+" ORDER BY key LIMIT 1", args...).Scan(&key)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return key, err
+}
+
+func (ss *SqlStorage) Save(key string, fields map[string]interface{}) error {
+	fieldsJson, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = ss.db.Exec(`INSERT INTO scalabel (key, fields) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET fields = excluded.fields`,
+		key, string(fieldsJson))
+	if err != nil {
+		return err
+	}
+	Info.Println("Saving row of", key)
+	return nil
+}
+
+func (ss *SqlStorage) Load(key string) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	var fieldsJson string
+	err := ss.db.QueryRow("SELECT fields FROM scalabel WHERE key = $1",
+		key).Scan(&fieldsJson)
+	if err == sql.ErrNoRows {
+		return fields, &NotExistError{key}
+	}
+	if err != nil {
+		return fields, err
+	}
+	err = json.Unmarshal([]byte(fieldsJson), &fields)
+	return fields, err
+}
+
+// Deletes a key and the keys under it, like a file and its directory in the
+// file storage
+func (ss *SqlStorage) Delete(key string) error {
+	start, end := keyRange(key)
+	_, err := ss.db.Exec(
+		"DELETE FROM scalabel WHERE key = $1 OR (key >= $2 AND key < $3)",
+		key, start, end)
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSqliteStorage(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "scalabel_sql_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	sqlStorage := &SqlStorage{Driver: "sqlite3"}
+	err = sqlStorage.Init(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{
+		"project1/project",
+		"project1/tasks/000000",
+		"project1/tasks/000001",
+		"project1/submissions/000000/alice/9",
+		"project1/submissions/000000/alice/10",
+		"project1/submissions/000000/alice2/11",
+		"project10/project",
+		// sorts between project1 and its keys
+		"project1-old/project",
+	}
+	for i, key := range keys {
+		err = sqlStorage.Save(key, map[string]interface{}{"Index": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = sqlStorage.Save(keys[1], map[string]interface{}{"Index": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := sqlStorage.Load(keys[1])
+	if err != nil || fields["Index"] != 7.0 {
+		t.Error("expected the saved fields to be replaced, got", fields, err)
+	}
+	_, err = sqlStorage.Load("project1/tasks/000002")
+	if _, ok := err.(*NotExistError); !ok {
+		t.Error("expected a NotExistError, got", err)
+	}
+	if !sqlStorage.HasKey("project1/project") ||
+		sqlStorage.HasKey("project1") {
+		t.Error("wrong HasKey")
+	}
+
+	// only the keys and directories directly under the prefix are listed
+	listed := map[string][]string{
+		"": {"project1", "project1-old", "project10"},
+		"project1": {"project1/project", "project1/submissions",
+			"project1/tasks"},
+		"project1/tasks": {"project1/tasks/000000", "project1/tasks/000001"},
+		"project1/submissions/000000/alice": {
+			"project1/submissions/000000/alice/10",
+			"project1/submissions/000000/alice/9"},
+		"project2": {},
+	}
+	for prefix, expected := range listed {
+		if keys := sqlStorage.ListKeys(prefix); !reflect.DeepEqual(keys,
+			expected) {
+			t.Errorf("wrong keys under %s: %v", prefix, keys)
+		}
+	}
+
+	// deleting a key deletes the keys under it
+	err = sqlStorage.Delete("project1/submissions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sqlStorage.ListKeys("project1/submissions/000000")) != 0 {
+		t.Error("expected the submissions to be deleted")
+	}
+	err = sqlStorage.Delete("project1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := sqlStorage.ListKeys(""); !reflect.DeepEqual(keys,
+		[]string{"project1-old", "project10"}) {
+		t.Error("expected only project1-old and project10 to be left, got",
+			keys)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -28,6 +29,35 @@ type Storage interface {
 	Delete(key string) error
 }
 
+// Lists the keys and the directories of keys directly under prefix among
+// the keys under it in order, like the files of a directory in the file
+// storage
+func childKeys(prefix string, keys []string) []string {
+	children := map[string]bool{}
+	for _, key := range keys {
+		child := strings.SplitN(strings.TrimPrefix(key[len(prefix):], "/"),
+			"/", 2)[0]
+		children[path.Join(prefix, child)] = true
+	}
+	sorted := []string{}
+	for key := range children {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// A storage which lists its keys under a prefix of its own
+type prefixedStorage interface {
+	listedPrefix() string
+}
+
+// A storage listing all the keys under a prefix, which can also list the
+// directories of keys directly under a prefix without reading their keys
+type directoryStorage interface {
+	listDirectories(prefix string) []string
+}
+
 //implement Storage interface
 type DynamodbStorage struct {
 	svc *dynamodb.DynamoDB
@@ -65,8 +95,8 @@ func (fs *FileStorage) ListKeys(prefix string) []string {
 	}
 
 	for _, f := range files {
-		key := f.Name()
-		key = key[:len(key)-5]
+		// directories of keys are listed without an extension
+		key := strings.TrimSuffix(f.Name(), ".json")
 		keys = append(keys, path.Join(prefix, key))
 	}
 	return keys
@@ -108,8 +138,13 @@ func (fs *FileStorage) Load(key string) (map[string]interface{}, error) {
 }
 
 func (fs *FileStorage) Delete(key string) error {
+	// a key is either a saved file or a directory of keys
+	err := os.RemoveAll(path.Join(fs.DataDir, key+".json"))
+	if err != nil {
+		return err
+	}
 	ItemDir := path.Join(fs.DataDir, key)
-	err := os.RemoveAll(ItemDir)
+	err = os.RemoveAll(ItemDir)
 	return err
 }
 
@@ -188,19 +223,34 @@ func (ds *DynamodbStorage) ListKeys(prefix string) []string {
 		ProjectionExpression:      expr.Projection(),
 		TableName:                 aws.String("scalabel"),
 	}
-	// Make the DynamoDB Query API call
-	result, err := ds.svc.Scan(params)
-	if err != nil {
-		Error.Println(err)
-	}
+	return scanKeys(ds.svc.Scan, params)
+}
+
+// Gets the keys of the items found by a scan. A scan reads at most 1 MB of
+// items, so the scan goes on after the last key of each page until the
+// whole table is read.
+func scanKeys(scan func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error),
+	params *dynamodb.ScanInput) []string {
 	keys := []string{}
-	for _, i := range result.Items {
-		var fields map[string]string
-		err = dynamodbattribute.UnmarshalMap(i, &fields)
-		keys = append(keys, fields["Key"])
-	}
-	if err != nil {
-		Error.Println(err)
+	for {
+		result, err := scan(params)
+		if err != nil {
+			Error.Println(err)
+			break
+		}
+		for _, item := range result.Items {
+			var fields map[string]string
+			err = dynamodbattribute.UnmarshalMap(item, &fields)
+			if err != nil {
+				Error.Println(err)
+				continue
+			}
+			keys = append(keys, fields["Key"])
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		params.ExclusiveStartKey = result.LastEvaluatedKey
 	}
 	return keys
 }
@@ -319,6 +369,11 @@ func (ss *S3Storage) HasKey(key string) bool {
 	return true
 }
 
+// The keys are listed with the data directory
+func (ss *S3Storage) listedPrefix() string {
+	return ss.DataDir
+}
+
 func (ss *S3Storage) ListKeys(prefix string) []string {
 	continuation_token := ""
 	keys := []string{}
@@ -353,6 +408,34 @@ func (ss *S3Storage) ListKeys(prefix string) []string {
 	return keys
 }
 
+// Lists the directories of keys directly under prefix, the objects under
+// them are grouped by S3
+func (ss *S3Storage) listDirectories(prefix string) []string {
+	dirPrefix := path.Join(ss.DataDir, prefix)
+	if dirPrefix != "" {
+		dirPrefix += "/"
+	}
+	dirs := []string{}
+	params := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(ss.BucketName),
+		Prefix:    aws.String(dirPrefix),
+		Delimiter: aws.String("/"),
+	}
+	err := ss.svc.ListObjectsV2Pages(params,
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, commonPrefix := range page.CommonPrefixes {
+				name := strings.TrimSuffix(strings.TrimPrefix(
+					*commonPrefix.Prefix, dirPrefix), "/")
+				dirs = append(dirs, path.Join(prefix, name))
+			}
+			return true
+		})
+	if err != nil {
+		Error.Println(err)
+	}
+	return dirs
+}
+
 func (ss *S3Storage) Save(key string, fields map[string]interface{}) error {
 	tmpfile, err := ioutil.TempFile("", "*.json")
 	if err != nil {
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default time in seconds for which a claimed task is reserved
+const defaultClaimLease = 3600
+
+//implements Serializable
+type TaskClaim struct {
+	ProjectName string `json:"projectName" yaml:"projectName"`
+	TaskIndex   int    `json:"taskIndex" yaml:"taskIndex"`
+	// user the task is assigned to, empty if any worker of the pool can
+	// claim it
+	AssignedTo string `json:"assignedTo" yaml:"assignedTo"`
+	// worker who claimed the task, empty if the task is not claimed
+	WorkerId   string `json:"workerId" yaml:"workerId"`
+	ClaimTime  int64  `json:"claimTime" yaml:"claimTime"`
+	ExpireTime int64  `json:"expireTime" yaml:"expireTime"`
+	// whether the task is submitted, submitted tasks are not claimed again
+	Submitted bool `json:"submitted" yaml:"submitted"`
+}
+
+func (claim *TaskClaim) GetKey() string {
+	return path.Join(claim.ProjectName, "claims", Index2str(claim.TaskIndex))
+}
+
+func (claim *TaskClaim) GetFields() map[string]interface{} {
+	return map[string]interface{}{
+		"ProjectName": claim.ProjectName,
+		"TaskIndex":   claim.TaskIndex,
+		"AssignedTo":  claim.AssignedTo,
+		"WorkerId":    claim.WorkerId,
+		"ClaimTime":   claim.ClaimTime,
+		"ExpireTime":  claim.ExpireTime,
+		"Submitted":   claim.Submitted,
+	}
+}
+
+// Checks if the task is claimed by a worker whose lease did not expire
+func (claim *TaskClaim) isActive(now int64) bool {
+	return claim.WorkerId != "" && claim.ExpireTime > now
+}
+
+// Checks if a worker may work on the task
+func (claim *TaskClaim) allows(workerId string, now int64) bool {
+	if claim.AssignedTo != "" && claim.AssignedTo != workerId {
+		return false
+	}
+	return !claim.isActive(now) || claim.WorkerId == workerId
+}
+
+// Claimed task as reported to the worker
+type TaskClaimResponse struct {
+	Claim TaskClaim `json:"claim"`
+	Url   string    `json:"url"`
+}
+
+// claims are read and written together, so a task is never handed out twice
+var claimLock sync.Mutex
+
+// Gets the claim of a task, tasks without a claim belong to the pool
+func GetTaskClaim(projectName string, taskIndex int) (TaskClaim, error) {
+	claim := TaskClaim{ProjectName: projectName, TaskIndex: taskIndex}
+	fields, err := storage.Load(claim.GetKey())
+	if err != nil {
+		if _, ok := err.(*NotExistError); ok {
+			return claim, nil
+		}
+		return claim, err
+	}
+	err = mapstructure.Decode(fields, &claim)
+	return claim, err
+}
+
+// Lease of the claims in seconds
+func claimLease() int64 {
+	if env.ClaimLease > 0 {
+		return int64(env.ClaimLease)
+	}
+	return defaultClaimLease
+}
+
+// Assigns tasks of a project to a user, or to the pool if the user is
+// empty. Claims of other workers are released.
+func AssignTasks(projectName string, taskIndices []int,
+	userId string) ([]TaskClaim, error) {
+	claimLock.Lock()
+	defer claimLock.Unlock()
+	claims := []TaskClaim{}
+	for _, taskIndex := range taskIndices {
+		claim, err := GetTaskClaim(projectName, taskIndex)
+		if err != nil {
+			return claims, err
+		}
+		claim.AssignedTo = userId
+		if userId != "" && claim.WorkerId != userId {
+			claim.WorkerId = ""
+			claim.ClaimTime = 0
+			claim.ExpireTime = 0
+		}
+		err = storage.Save(claim.GetKey(), claim.GetFields())
+		if err != nil {
+			return claims, err
+		}
+		claims = append(claims, claim)
+	}
+	if userId != "" {
+		addUserProject(userId, projectName)
+	}
+	return claims, nil
+}
+
+// Marks the task as submitted on its claim, or as open again
+func setTaskSubmitted(projectName string, taskIndex int,
+	submitted bool) error {
+	claimLock.Lock()
+	defer claimLock.Unlock()
+	claim, err := GetTaskClaim(projectName, taskIndex)
+	if err != nil {
+		return err
+	}
+	if claim.Submitted == submitted {
+		return nil
+	}
+	claim.Submitted = submitted
+	return storage.Save(claim.GetKey(), claim.GetFields())
+}
+
+// Records the submission of a task, which leaves the pool and is scored.
+// Errors are only logged so that the submission itself succeeds.
+func recordSubmission(projectName string, taskIndex string, workerId string,
+	submitTime int64, exportTask exportTaskFunc) {
+	index, err := strconv.Atoi(taskIndex)
+	if err != nil {
+		Error.Println(err)
+		return
+	}
+	err = setTaskSubmitted(projectName, index, true)
+	if err != nil {
+		Error.Println(err)
+	}
+	scoreSubmission(projectName, taskIndex, workerId, submitTime, exportTask)
+}
+
+// Gets the indices of the tasks of a project from the keys of the tasks
+func listTaskIndices(projectName string) []int {
+	indices := []int{}
+	for _, key := range storage.ListKeys(path.Join(projectName, "tasks")) {
+		index, err := strconv.Atoi(path.Base(listedKey(storage, key)))
+		if err != nil {
+			continue
+		}
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// Claims the next task of a project the worker may work on. A task the
+// worker already claimed comes first, then tasks assigned to the worker,
+// then the tasks of the pool. Submitted tasks are skipped. Returns false if
+// no task is left.
+func ClaimTask(projectName string, workerId string) (TaskClaim, bool, error) {
+	claimLock.Lock()
+	defer claimLock.Unlock()
+	now := recordTimestamp()
+	candidates := []TaskClaim{}
+	for _, taskIndex := range listTaskIndices(projectName) {
+		claim, err := GetTaskClaim(projectName, taskIndex)
+		if err != nil {
+			return TaskClaim{}, false, err
+		}
+		if !claim.allows(workerId, now) || claim.Submitted {
+			continue
+		}
+		candidates = append(candidates, claim)
+	}
+	if len(candidates) == 0 {
+		return TaskClaim{}, false, nil
+	}
+	rank := func(claim TaskClaim) int {
+		if claim.isActive(now) {
+			return 0
+		}
+		if claim.AssignedTo != "" {
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return rank(candidates[i]) < rank(candidates[j])
+	})
+	claim := candidates[0]
+	if !claim.isActive(now) {
+		claim.WorkerId = workerId
+		claim.ClaimTime = now
+	}
+	claim.ExpireTime = now + claimLease()
+	err := storage.Save(claim.GetKey(), claim.GetFields())
+	if err != nil {
+		return claim, false, err
+	}
+	taskIndex := Index2str(claim.TaskIndex)
+	if !storage.HasKey(path.Join(projectName, "assignments", taskIndex,
+		workerId)) {
+		_, err = CreateAssignment(projectName, taskIndex, workerId)
+		if err != nil {
+			return claim, false, err
+		}
+	}
+	addUserProject(workerId, projectName)
+	return claim, true, nil
+}
+
+// Checks if a worker may open a task. Tasks are only reserved when the
+// User Management System is on, since everyone is the same worker otherwise.
+func canOpenTask(r *http.Request, projectName string, taskIndex int) bool {
+	if !isUserManagementOn() || isAdmin(r) {
+		return true
+	}
+	claim, err := GetTaskClaim(projectName, taskIndex)
+	if err != nil {
+		Error.Println(err)
+		return false
+	}
+	return claim.allows(getWorkerId(r), recordTimestamp())
+}
+
+// Checks if the user sending a request is an admin. Without user management
+// everyone is.
+func isAdmin(r *http.Request) bool {
+	if !isUserManagementOn() {
+		return true
+	}
+	user, ok := Users[getWorkerId(r)]
+	return ok && user.Group == "admin"
+}
+
+// Adds a project to the projects of a user
+func addUserProject(userId string, projectName string) {
+	user, ok := Users[userId]
+	if !ok {
+		return
+	}
+	for _, name := range user.Projects {
+		if name == projectName {
+			return
+		}
+	}
+	user.Projects = append(user.Projects, projectName)
+}
+
+// Finds the projects with tasks assigned to or claimed by a user
+func getUserProjects(userId string) []string {
+	projects := []string{}
+	for _, projectName := range GetExistingProjects() {
+		for _, key := range storage.ListKeys(path.Join(projectName, "claims")) {
+			fields, err := storage.Load(key)
+			if err != nil {
+				Error.Println(err)
+				continue
+			}
+			claim := TaskClaim{}
+			err = mapstructure.Decode(fields, &claim)
+			if err != nil {
+				Error.Println(err)
+				continue
+			}
+			if claim.AssignedTo == userId || claim.WorkerId == userId {
+				projects = append(projects, projectName)
+				break
+			}
+		}
+	}
+	return projects
+}
+
+// Parses task indices such as "0,2,5-9". All the tasks are selected if the
+// value is empty.
+func parseTaskIndices(value string, tasks []Task) ([]int, error) {
+	indices := []int{}
+	if strings.TrimSpace(value) == "" {
+		for _, task := range tasks {
+			indices = append(indices, task.Index)
+		}
+		return indices, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return indices, fmt.Errorf("Invalid task index %s", part)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil || end < start {
+				return indices, fmt.Errorf("Invalid task range %s", part)
+			}
+		}
+		if start < 0 || end >= len(tasks) {
+			return indices, fmt.Errorf("Task %s does not exist", part)
+		}
+		for i := start; i <= end; i++ {
+			indices = append(indices, i)
+		}
+	}
+	return indices, nil
+}
+
+// Handles the assignment of tasks to a user or to the pool by an admin
+func postAssignTasksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can assign tasks", http.StatusForbidden)
+		return
+	}
+	projectName := r.FormValue("project_name")
+	tasks, err := GetTasksInProject(projectName)
+	if err != nil || len(tasks) == 0 {
+		http.Error(w, fmt.Sprintf("Project %s has no tasks", projectName),
+			http.StatusBadRequest)
+		return
+	}
+	taskIndices, err := parseTaskIndices(r.FormValue("tasks"), tasks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	claims, err := AssignTasks(projectName, taskIndices, r.FormValue("user"))
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	claimsJson, err := json.Marshal(claims)
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(claimsJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
+
+// Handles the claim of the next task of a project by a worker
+func postClaimTaskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	projectName := r.FormValue("project_name")
+	claim, ok, err := ClaimTask(projectName, getWorkerId(r))
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("No task of %s is left", projectName),
+			http.StatusNotFound)
+		return
+	}
+	task, err := GetTask(projectName, Index2str(claim.TaskIndex))
+	if err != nil {
+		Error.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	taskUrl, err := getTaskUrl(r, projectName, task)
+	if err != nil {
+		Error.Println(err)
+	}
+	responseJson, err := json.Marshal(TaskClaimResponse{claim, taskUrl})
+	if err != nil {
+		Error.Println(err)
+	}
+	_, err = w.Write(responseJson)
+	if err != nil {
+		Error.Println(err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+)
+
+const claimTestProject = "scalabel_claim_test"
+
+func saveClaimTestTasks(t *testing.T) {
+	saveTestProject(t, claimTestProject, [][]Item{{{Url: "a.jpg"}},
+		{{Url: "a.jpg"}}, {{Url: "a.jpg"}}}, nil)
+}
+
+func claimTestTask(t *testing.T, workerId string) int {
+	claim, ok, err := ClaimTask(claimTestProject, workerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		return -1
+	}
+	if claim.WorkerId != workerId {
+		t.Error("wrong worker of claim", claim)
+	}
+	return claim.TaskIndex
+}
+
+func TestClaimTask(t *testing.T) {
+	saveClaimTestTasks(t)
+	defer deleteTestProject(t, claimTestProject)
+	_, err := AssignTasks(claimTestProject, []int{1}, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		workerId  string
+		taskIndex int
+	}{
+		{"alice", 0},
+		// a worker keeps the claimed task
+		{"alice", 0},
+		// the task of bob is not in the pool
+		{"carol", 2},
+		{"bob", 1},
+		{"dave", -1},
+	}
+	for _, e := range expected {
+		if taskIndex := claimTestTask(t, e.workerId); taskIndex != e.taskIndex {
+			t.Error("expected", e.workerId, "to claim", e.taskIndex, "got",
+				taskIndex)
+		}
+	}
+	if !storage.HasKey(path.Join(claimTestProject, "assignments",
+		Index2str(2), "carol")) {
+		t.Error("expected an assignment of the claimed task")
+	}
+	// the lease of alice expires
+	claim, err := GetTaskClaim(claimTestProject, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim.ExpireTime = recordTimestamp() - 1
+	err = storage.Save(claim.GetKey(), claim.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taskIndex := claimTestTask(t, "dave"); taskIndex != 0 {
+		t.Error("expected dave to claim the expired task, got", taskIndex)
+	}
+}
+
+func TestClaimSubmittedTask(t *testing.T) {
+	saveClaimTestTasks(t)
+	defer deleteTestProject(t, claimTestProject)
+	if taskIndex := claimTestTask(t, DefaultWorker); taskIndex != 0 {
+		t.Fatal("expected to claim the first task, got", taskIndex)
+	}
+	assignment, err := GetAssignment(claimTestProject, Index2str(0),
+		DefaultWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sat := assignmentToSat(&assignment)
+	sat.Submit = true
+	satJson, err := json.Marshal(sat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "postSaveV2",
+		bytes.NewReader(satJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	postSaveV2Handler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Save handler HTTP code:", rr.Code)
+	}
+	// the submitted v2 task is not claimed again
+	claim, err := GetTaskClaim(claimTestProject, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claim.Submitted {
+		t.Error("expected the claim to be submitted", claim)
+	}
+	claim.ExpireTime = recordTimestamp() - 1
+	err = storage.Save(claim.GetKey(), claim.GetFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taskIndex := claimTestTask(t, DefaultWorker); taskIndex != 1 {
+		t.Error("expected to claim the next task, got", taskIndex)
+	}
+	// a rejected task is open again
+	err = SubmitReview(Review{ProjectName: claimTestProject, TaskIndex: 0,
+		WorkerId: DefaultWorker, Status: ReviewRejected,
+		SubmitTime: latestSaveTime(claimTestProject, Index2str(0),
+			DefaultWorker)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim, err = GetTaskClaim(claimTestProject, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Submitted || claim.AssignedTo != DefaultWorker {
+		t.Error("expected the rejected task to be open, got", claim)
+	}
+}
+
+func TestClaimTaskHandler(t *testing.T) {
+	saveClaimTestTasks(t)
+	defer deleteTestProject(t, claimTestProject)
+	req, err := http.NewRequest("POST", "/claimTask",
+		strings.NewReader("project_name="+claimTestProject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	postClaimTaskHandler(rr, req)
+	if rr.Code != 200 {
+		t.Fatal("Claim task handler HTTP code:", rr.Code, rr.Body.String())
+	}
+	response := TaskClaimResponse{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Claim.WorkerId != DefaultWorker ||
+		!strings.Contains(response.Url, "task_index=000000") {
+		t.Error("wrong claim", response)
+	}
+}
+
+func TestParseTaskIndices(t *testing.T) {
+	tasks := make([]Task, 10)
+	indices, err := parseTaskIndices("0, 2,5-7", tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indices) != 5 || indices[1] != 2 || indices[4] != 7 {
+		t.Error("wrong indices", indices)
+	}
+	indices, err = parseTaskIndices("", tasks)
+	if err != nil || len(indices) != 10 {
+		t.Error("expected every task, got", indices, err)
+	}
+	for _, value := range []string{"a", "3-1", "9-10"} {
+		if _, err = parseTaskIndices(value, tasks); err == nil {
+			t.Error("expected", value, "to be invalid")
+		}
+	}
+}
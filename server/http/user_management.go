@@ -208,6 +208,22 @@ func getJson(url string, target interface{}) error {
 	return json.NewDecoder(r.Body).Decode(target)
 }
 
+// Gets the group of a user from the cognito groups of its id token. Admins
+// are also reviewers, and users are workers by default.
+func userGroup(groups interface{}) string {
+	groupNames, _ := groups.([]interface{})
+	group := "worker"
+	for _, groupName := range groupNames {
+		switch fmt.Sprint(groupName) {
+		case "admin":
+			return "admin"
+		case "reviewer":
+			group = "reviewer"
+		}
+	}
+	return group
+}
+
 func validateIdToken(tokenStr, region, userPoolId string,
 	jwk map[string]JWKKey) (*jwt.Token, User, error) {
 	// Initialize userInfo
@@ -254,16 +270,10 @@ func validateIdToken(tokenStr, region, userPoolId string,
 	}
 	id := fmt.Sprint(sub)
 
-	/* set group as worker by default, only assign group to be admin
-	when the user has group attribute and the user's group is admin
+	/* set group as worker by default, only assign group to be admin or
+	reviewer when the user has group attribute with one of them
 	*/
-	groups, ok := claims["cognito:groups"]
-	group := fmt.Sprint(groups)
-	if ok && group == "[admin]" { // if admin
-		group = group[1 : len(group)-1]
-	} else { // by default, users are worker
-		group = "worker"
-	}
+	group := userGroup(claims["cognito:groups"])
 
 	// email
 	Email, ok := claims["email"]
@@ -273,8 +283,15 @@ func validateIdToken(tokenStr, region, userPoolId string,
 	}
 	emailaddress := fmt.Sprint(Email)
 
+	// name, which users may not have
+	name := ""
+	if claimName, ok := claims["name"]; ok {
+		name = fmt.Sprint(claimName)
+	}
+
 	userInfo = User{
 		Id:           id,
+		Name:         name,
 		Email:        emailaddress,
 		Group:        group,
 		RefreshToken: "",
@@ -300,6 +317,21 @@ func validateIdToken(tokenStr, region, userPoolId string,
 	return token, userInfo, err
 }
 
+// Gets the name of a user shown to other users, which is the email of the
+// user if the user has no name, or the id if the user is unknown
+func userName(id string) string {
+	user, ok := Users[id]
+	switch {
+	case !ok:
+		return id
+	case user.Name != "":
+		return user.Name
+	case user.Email != "":
+		return user.Email
+	}
+	return id
+}
+
 // Verify the refreshToken feteched from cookie by id as the key
 func verifyRefreshToken(refreshToken string, id string) bool {
 	// check if any of them is empty, return false
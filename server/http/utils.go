@@ -17,7 +17,7 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
-// TODO: use actual worker ID
+// Worker of all the requests when user management is off
 const DefaultWorker = "default_worker"
 
 type NotExistError struct {
@@ -33,22 +33,31 @@ func Index2str(id int) string {
 }
 
 /**
- * Fetch names of all existing projects in the data folder
+ * Fetch names of all existing projects in the storage
 **/
 func GetExistingProjects() []string {
-	files, err := ioutil.ReadDir(env.DataDir)
 	names := []string{}
-	if err != nil {
-		return names
+	found := map[string]bool{}
+	// storages listing all the keys under a prefix only list the top level
+	// directories, the other storages list them anyway
+	var keys []string
+	if dirs, ok := unwrapStorage(storage).(directoryStorage); ok {
+		keys = dirs.listDirectories("")
+	} else {
+		keys = storage.ListKeys("")
 	}
-
-	for _, f := range files {
-		name := f.Name()
-		// remove hidden files and the config file
-		if !strings.ContainsAny(name, ".") {
+	for _, key := range keys {
+		name := strings.SplitN(listedKey(storage, key), "/", 2)[0]
+		if found[name] {
+			continue
+		}
+		found[name] = true
+		// skip hidden files, the config file and other keys of the storage
+		if storage.HasKey(path.Join(name, "project")) {
 			names = append(names, name)
 		}
 	}
+	sort.Strings(names)
 	return names
 }
 
@@ -119,9 +128,7 @@ func GetTasksInProject(projectName string) ([]Task, error) {
 func GetAssignment(projectName string, taskIndex string,
 	workerId string) (Assignment, error) {
 	assignment := Assignment{}
-	submissionsPath := path.Join(projectName, "submissions",
-		taskIndex, workerId)
-	keys := storage.ListKeys(submissionsPath)
+	keys := listSubmissionKeys(projectName, taskIndex, workerId)
 	// if any submissions exist, get the most recent one
 	if len(keys) > 0 {
 		fields, err := storage.Load(keys[len(keys)-1])
@@ -132,6 +139,7 @@ func GetAssignment(projectName string, taskIndex string,
 		if err != nil {
 			Error.Println(err)
 		}
+		assignment.Revision = assignment.SubmitTime
 	} else {
 		assignmentPath := path.Join(projectName, "assignments",
 			taskIndex, workerId)
@@ -143,6 +151,7 @@ func GetAssignment(projectName string, taskIndex string,
 		if err != nil {
 			Error.Println(err)
 		}
+		assignment.Revision = assignment.StartTime
 	}
 	// Asssigns default value for BundleFile
 	// Should get rid of this and separate bundleFiles in the future
@@ -158,6 +167,10 @@ func CreateAssignment(projectName string, taskIndex string,
 	if err != nil {
 		return Assignment{}, err
 	}
+	// workers do not see the ground truth of gold-standard items
+	for i := range task.Items {
+		task.Items[i].GroundTruth = nil
+	}
 	uuid := getUuidV4()
 	assignment := Assignment{
 		Id:        uuid,
@@ -202,10 +215,25 @@ func GetDashboardContents(projectName string) (DashboardContents, error) {
 		}
 		taskMetaDatas = append(taskMetaDatas, taskMetaData)
 	}
-	return DashboardContents{
+	contents := DashboardContents{
 		ProjectMetaData: projectMetaData,
 		TaskMetaDatas:   taskMetaDatas,
-	}, nil
+	}
+	// the scores are optional, the dashboard is shown without them
+	workerScores, err := GetProjectWorkerScores(projectName)
+	if err != nil {
+		Error.Println(err)
+		return contents, nil
+	}
+	contents.WorkerScores = workerScores
+	return contents, nil
+}
+
+// Checks whether a project is labeled with the v2 interface, which is given
+// by its item type and label type
+func isV2Project(options ProjectOptions) bool {
+	handlerUrl := GetHandlerUrl(options.ItemType, options.LabelType)
+	return handlerUrl == "label2dv2" || handlerUrl == "label3dv2"
 }
 
 func GetHandlerUrl(itemType string, labelType string) string {
@@ -247,6 +275,17 @@ func recordTimestamp() int64 {
 	return time.Now().Unix()
 }
 
+// Gets the time of a new revision saved after the latest one. Revisions
+// saved within the same second get the following seconds, so that no
+// revision overwrites another.
+func nextRevisionTime(latest int64) int64 {
+	submitTime := recordTimestamp()
+	if submitTime <= latest {
+		submitTime = latest + 1
+	}
+	return submitTime
+}
+
 func Exists(name string) bool {
 	_, err := os.Stat(name)
 	return !os.IsNotExist(err)
@@ -260,6 +299,13 @@ func Min(x, y int) int {
 	return y
 }
 
+func Max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
 // check duplicated project name
 // return false if duplicated
 func CheckProjectName(projectName string) string {
@@ -272,7 +318,8 @@ func CheckProjectName(projectName string) string {
 
 }
 
-// Count the total number of images labeled in a task
+// Count the number of images labeled in a task by the worker who labeled
+// the most images
 func countLabeledImages(projectName string, index int) int {
 	// return the number of labeled images in the import file if not initialized
 	task, err := GetTask(projectName, Index2str(index))
@@ -282,18 +329,14 @@ func countLabeledImages(projectName string, index int) int {
 	if task.NumLabeledItemImport > 0 {
 		return task.NumLabeledItemImport
 	}
-	assignment, err := GetAssignment(projectName, Index2str(index),
-		DefaultWorker)
-	if err != nil {
-		if _, ok := err.(*NotExistError); !ok {
-			Error.Println(err)
-			return 0
-		}
+	numLabeledItems := 0
+	for _, assignment := range getWorkerAssignments(projectName, index) {
+		numLabeledItems = Max(numLabeledItems, assignment.NumLabeledItems)
 	}
-	return assignment.NumLabeledItems
+	return numLabeledItems
 }
 
-// Count the total number of labels in a task
+// Count the total number of labels of all the workers in a task
 func countLabelsInTask(projectName string, index int) int {
 	// return the number of labels in the import file if not initialized
 	task, err := GetTask(projectName, Index2str(index))
@@ -303,36 +346,149 @@ func countLabelsInTask(projectName string, index int) int {
 	if task.NumLabelImport > 0 {
 		return task.NumLabelImport
 	}
-	assignment, err := GetAssignment(projectName, Index2str(index),
-		DefaultWorker)
-	if err != nil {
-		if _, ok := err.(*NotExistError); !ok {
-			Error.Println(err)
-			return 0
-		}
-	}
-	// Count labels
-	numLabels := len(assignment.Labels)
-	// for videos, count the number of keyframes
-	if assignment.Task.ProjectOptions.ItemType == "video" {
-		numLabels = 0
-		for _, label := range assignment.Labels {
-			if label.Keyframe {
-				numLabels++
+	numLabels := 0
+	for _, assignment := range getWorkerAssignments(projectName, index) {
+		// for videos, count the number of keyframes
+		if assignment.Task.ProjectOptions.ItemType == "video" {
+			for _, label := range assignment.Labels {
+				if label.Keyframe {
+					numLabels++
+				}
 			}
+		} else {
+			numLabels += len(assignment.Labels)
 		}
 	}
 	return numLabels
 }
 
-// Check if a given task is submitted
+// Check if any worker submitted a given task
 func taskSubmitted(projectName string, index int) bool {
-	assignment, err := GetAssignment(projectName, Index2str(index),
-		DefaultWorker)
-	if err != nil {
-		return false
+	for _, assignment := range getWorkerAssignments(projectName, index) {
+		if assignment.Task.ProjectOptions.Submitted {
+			return true
+		}
 	}
-	return assignment.Task.ProjectOptions.Submitted
+	return false
+}
+
+// Get the latest assignment of every worker of a task
+func getWorkerAssignments(projectName string, index int) []Assignment {
+	assignments := []Assignment{}
+	for _, workerId := range GetTaskWorkers(projectName, Index2str(index)) {
+		assignment, err := GetAssignment(projectName, Index2str(index),
+			workerId)
+		if err != nil {
+			if _, ok := err.(*NotExistError); !ok {
+				Error.Println(err)
+			}
+			continue
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments
+}
+
+// GetTaskWorkers lists the workers with an assignment of a task
+func GetTaskWorkers(projectName string, taskIndex string) []string {
+	workers := []string{}
+	for _, key := range listChildKeys(path.Join(projectName, "assignments",
+		taskIndex)) {
+		workers = append(workers, path.Base(key))
+	}
+	return workers
+}
+
+// Finds the worker who saved the latest submission of a task. If nobody
+// saved the task yet, it is the first worker with an assignment.
+func getLatestTaskWorker(projectName string, taskIndex string) string {
+	workers := GetTaskWorkers(projectName, taskIndex)
+	if len(workers) == 0 {
+		return DefaultWorker
+	}
+	latestWorker := workers[0]
+	var latestTime int64 = -1
+	for _, workerId := range workers {
+		keys := listSubmissionKeys(projectName, taskIndex, workerId)
+		if len(keys) == 0 {
+			continue
+		}
+		submitTime, err := strconv.ParseInt(path.Base(keys[len(keys)-1]),
+			10, 64)
+		if err != nil {
+			Error.Println(err)
+			continue
+		}
+		if submitTime > latestTime {
+			latestWorker = workerId
+			latestTime = submitTime
+		}
+	}
+	return latestWorker
+}
+
+// Lists the keys directly under prefix in order. Storages which list keys
+// by prefix also return the keys of longer names and of subdirectories,
+// such as the submissions of "worker2" for the prefix "worker".
+func listChildKeys(prefix string) []string {
+	keys := []string{}
+	for _, key := range storage.ListKeys(prefix) {
+		key = listedKey(storage, key)
+		if path.Dir(key) == prefix {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Lists the keys of the submissions of a worker on a task from the oldest
+// to the latest
+func listSubmissionKeys(projectName string, taskIndex string,
+	workerId string) []string {
+	return listTimeKeys(path.Join(projectName, "submissions", taskIndex,
+		workerId))
+}
+
+// Lists the keys under prefix which end with a time from the oldest to the
+// latest. Times are compared as numbers since times of different lengths do
+// not sort as text.
+func listTimeKeys(prefix string) []string {
+	keys := listChildKeys(prefix)
+	submitTime := func(key string) int64 {
+		time, err := strconv.ParseInt(path.Base(key), 10, 64)
+		if err != nil {
+			return -1
+		}
+		return time
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return submitTime(keys[i]) < submitTime(keys[j])
+	})
+	return keys
+}
+
+// Gets the id of the worker sending a request, which is the id of the
+// authenticated user. Without user management every request comes from the
+// default worker.
+func getWorkerId(r *http.Request) string {
+	if !isUserManagementOn() {
+		return DefaultWorker
+	}
+	idCookie, err := r.Cookie("idScalabel")
+	if err != nil || idCookie.Value == "" {
+		return DefaultWorker
+	}
+	if _, ok := Users[idCookie.Value]; !ok {
+		return DefaultWorker
+	}
+	return idCookie.Value
+}
+
+// Checks if the User Management System is on
+func isUserManagementOn() bool {
+	return env.UserManagement == "on" ||
+		env.UserManagement == "On" || env.UserManagement == "ON"
 }
 
 // Get UUIDv4
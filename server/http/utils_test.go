@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"testing"
+)
+
+const workerTestProject = "scalabel_worker_test"
+
+// Saves the assignments and submissions of two workers of the same task
+func saveWorkerTestAssignments(t *testing.T) {
+	submissions := []testSubmission{}
+	for i, workerId := range []string{"alice", "alice2"} {
+		submission := testSubmission{workerId: workerId,
+			submitTime: int64(100 + i)}
+		for j := 0; j <= i; j++ {
+			submission.labels = append(submission.labels, Label{Id: j})
+		}
+		submissions = append(submissions, submission)
+	}
+	saveTestProject(t, workerTestProject, [][]Item{{{Url: "a.jpg"}}},
+		submissions)
+}
+
+func TestTaskWorkers(t *testing.T) {
+	saveWorkerTestAssignments(t)
+	defer deleteTestProject(t, workerTestProject)
+	workers := GetTaskWorkers(workerTestProject, Index2str(0))
+	if len(workers) != 2 || workers[0] != "alice" || workers[1] != "alice2" {
+		t.Fatal("wrong workers", workers)
+	}
+	// the submissions of alice2 are not the ones of alice
+	assignment, err := GetAssignment(workerTestProject, Index2str(0), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assignment.WorkerId != "alice" || len(assignment.Labels) != 1 {
+		t.Error("wrong assignment of alice", assignment)
+	}
+	latestWorker := getLatestTaskWorker(workerTestProject, Index2str(0))
+	if latestWorker != "alice2" {
+		t.Error("expected the latest submission of alice2, got", latestWorker)
+	}
+	if numLabels := countLabelsInTask(workerTestProject, 0); numLabels != 3 {
+		t.Error("expected the 3 labels of both workers, got", numLabels)
+	}
+	if numItems := countLabeledImages(workerTestProject, 0); numItems != 1 {
+		t.Error("expected 1 labeled image, got", numItems)
+	}
+}
+
+// A storage listing its keys with a data directory like the S3 storage
+type prefixedTestStorage struct {
+	Storage
+}
+
+func (s *prefixedTestStorage) listedPrefix() string {
+	return "data"
+}
+
+func (s *prefixedTestStorage) ListKeys(prefix string) []string {
+	keys := []string{}
+	for _, key := range s.Storage.ListKeys(prefix) {
+		keys = append(keys, path.Join("data", key))
+	}
+	return keys
+}
+
+func TestPrefixedTaskWorkers(t *testing.T) {
+	saveWorkerTestAssignments(t)
+	backend := storage
+	storage = &prefixedTestStorage{backend}
+	defer func() {
+		storage = backend
+		deleteTestProject(t, workerTestProject)
+	}()
+	workers := GetTaskWorkers(workerTestProject, Index2str(0))
+	if len(workers) != 2 || workers[0] != "alice" || workers[1] != "alice2" {
+		t.Fatal("wrong workers", workers)
+	}
+	keys := listSubmissionKeys(workerTestProject, Index2str(0), "alice2")
+	if len(keys) != 1 || keys[0] != path.Join(workerTestProject,
+		"submissions", Index2str(0), "alice2", "101") {
+		t.Error("wrong submission keys", keys)
+	}
+	assignment, err := GetAssignment(workerTestProject, Index2str(0),
+		"alice2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignment.Labels) != 2 {
+		t.Error("expected the latest submission of alice2, got", assignment)
+	}
+}
+
+// A storage listing the directories of keys like the S3 storage
+type directoryTestStorage struct {
+	Storage
+	t *testing.T
+}
+
+func (s *directoryTestStorage) listDirectories(prefix string) []string {
+	return s.Storage.ListKeys(prefix)
+}
+
+func (s *directoryTestStorage) ListKeys(prefix string) []string {
+	if prefix == "" {
+		s.t.Error("expected the directories to be listed instead of the keys")
+	}
+	return s.Storage.ListKeys(prefix)
+}
+
+func TestDirectoryExistingProjects(t *testing.T) {
+	project := Project{Options: ProjectOptions{Name: workerTestProject}}
+	saveTestKey(t, project.GetKey(), project.GetFields())
+	backend := storage
+	storage = &directoryTestStorage{backend, t}
+	defer func() {
+		storage = backend
+		deleteTestProject(t, workerTestProject)
+	}()
+	found := false
+	for _, name := range GetExistingProjects() {
+		found = found || name == workerTestProject
+	}
+	if !found {
+		t.Error("expected the project to exist")
+	}
+}
+
+func TestGetExistingProjects(t *testing.T) {
+	task := Task{ProjectOptions: ProjectOptions{Name: workerTestProject}}
+	saveTestKey(t, task.GetKey(), task.GetFields())
+	defer deleteTestProject(t, workerTestProject)
+	contains := func(names []string) bool {
+		for _, name := range names {
+			if name == workerTestProject {
+				return true
+			}
+		}
+		return false
+	}
+	// only the keys of a project make it a project
+	if contains(GetExistingProjects()) {
+		t.Error("expected the tasks without project to be skipped")
+	}
+	project := Project{Options: task.ProjectOptions}
+	saveTestKey(t, project.GetKey(), project.GetFields())
+	if !contains(GetExistingProjects()) {
+		t.Error("expected the project to exist")
+	}
+}
+
+func TestGetWorkerId(t *testing.T) {
+	req, err := http.NewRequest("GET", "label2d", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: "idScalabel", Value: "worker_test_user"})
+	if workerId := getWorkerId(req); workerId != DefaultWorker {
+		t.Error("expected the default worker without user management, got",
+			workerId)
+	}
+	userManagement := env.UserManagement
+	env.UserManagement = "on"
+	Users["worker_test_user"] = &User{Id: "worker_test_user"}
+	defer func() {
+		env.UserManagement = userManagement
+		delete(Users, "worker_test_user")
+	}()
+	if workerId := getWorkerId(req); workerId != "worker_test_user" {
+		t.Error("expected the id of the user, got", workerId)
+	}
+}